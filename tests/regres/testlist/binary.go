@@ -0,0 +1,352 @@
+// Copyright 2019 The SwiftShader Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testlist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"../cause"
+)
+
+// binaryMagic is the header of the binary encoding of Lists, followed by the
+// encoding version.
+const binaryMagic = "TESTLIST"
+
+const (
+	// binaryVersionGob is the version of the binary encoding of Lists that
+	// holds the gob encoded groups. It is still decoded, but no longer
+	// produced.
+	binaryVersionGob = 1
+	// binaryVersion is the current version of the binary encoding of Lists.
+	binaryVersion = 2
+)
+
+// MarshalBinary returns the lists in a compact binary encoding, which can be
+// decoded with UnmarshalBinary. The encoding begins with a magic header and
+// version number, followed by the groups. Strings and lists are length
+// prefixed, and each test name is stored as the length of the prefix it
+// shares with the previous name followed by the rest of the name, so the
+// sorted names of a group take little more space than their distinct
+// suffixes. Nil and empty slices and maps are kept distinct, so the lists are
+// decoded exactly as they were encoded.
+func (l Lists) MarshalBinary() ([]byte, error) {
+	w := binaryWriter{}
+	w.buf.WriteString(binaryMagic)
+	w.buf.WriteByte(binaryVersion)
+	w.count(len(l), l == nil)
+	for _, group := range l {
+		w.string(group.Name)
+		w.string(group.File)
+		w.string(string(group.API))
+		w.names(group.Tests)
+		w.metaMap(group.Platforms)
+		w.metaMap(group.Flags)
+		w.metaMap(group.After)
+		w.expectations(group.Expectations)
+		w.names(group.Disabled)
+		w.int(int64(group.Timeout))
+		w.stringMap(group.Meta)
+	}
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes lists encoded with Lists.MarshalBinary.
+func UnmarshalBinary(data []byte) (Lists, error) {
+	var l Lists
+	if err := l.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// UnmarshalBinary replaces l with the lists encoded with Lists.MarshalBinary.
+// Together with MarshalBinary, this lets values holding a Lists be gob
+// encoded.
+func (l *Lists) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(binaryMagic)) {
+		return fmt.Errorf("Data is not a binary encoded test list")
+	}
+	data = data[len(binaryMagic):]
+	if len(data) == 0 {
+		return fmt.Errorf("Unsupported binary test list version")
+	}
+	switch data[0] {
+	case binaryVersionGob:
+		var groups []Group
+		if err := gob.NewDecoder(bytes.NewReader(data[1:])).Decode(&groups); err != nil {
+			return cause.Wrap(err, "Couldn't decode test list")
+		}
+		*l = Lists(groups)
+		return nil
+	case binaryVersion:
+	default:
+		return fmt.Errorf("Unsupported binary test list version %d", data[0])
+	}
+
+	r := binaryReader{data: data[1:]}
+	n := r.count()
+	var out Lists
+	if n >= 0 {
+		out = make(Lists, 0, n)
+	}
+	for i := 0; i < n && r.err == nil; i++ {
+		group := Group{}
+		group.Name = r.string()
+		group.File = r.string()
+		group.API = API(r.string())
+		group.Tests = r.names()
+		group.Platforms = r.metaMap()
+		group.Flags = r.metaMap()
+		group.After = r.metaMap()
+		group.Expectations = r.expectations()
+		group.Disabled = r.names()
+		group.Timeout = time.Duration(r.int())
+		group.Meta = r.stringMap()
+		out = append(out, group)
+	}
+	if r.err == nil && len(r.data) > 0 {
+		r.err = fmt.Errorf("%d unexpected trailing bytes", len(r.data))
+	}
+	if r.err != nil {
+		return cause.Wrap(r.err, "Couldn't decode test list")
+	}
+	*l = out
+	return nil
+}
+
+// binaryWriter writes the parts of the binary encoding of Lists.
+type binaryWriter struct {
+	buf     bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (w *binaryWriter) uint(v uint64) {
+	w.buf.Write(w.scratch[:binary.PutUvarint(w.scratch[:], v)])
+}
+
+func (w *binaryWriter) int(v int64) {
+	w.buf.Write(w.scratch[:binary.PutVarint(w.scratch[:], v)])
+}
+
+func (w *binaryWriter) string(s string) {
+	w.uint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+// count writes the length of a slice or map that is nil if isNil is true.
+// Nil is written as 0, and a length of n as n+1.
+func (w *binaryWriter) count(n int, isNil bool) {
+	if isNil {
+		w.uint(0)
+	} else {
+		w.uint(uint64(n) + 1)
+	}
+}
+
+// names writes the list of names, each as the length of the prefix shared with
+// the previous name, followed by the rest of the name.
+func (w *binaryWriter) names(names []string) {
+	w.count(len(names), names == nil)
+	prev := ""
+	for _, name := range names {
+		shared := 0
+		for shared < len(prev) && shared < len(name) && prev[shared] == name[shared] {
+			shared++
+		}
+		w.uint(uint64(shared))
+		w.string(name[shared:])
+		prev = name
+	}
+}
+
+// keys writes the sorted keys of a map with the given keys, or nil if isNil
+// is true, using names.
+func (w *binaryWriter) keys(keys []string, isNil bool) {
+	if isNil {
+		w.names(nil)
+		return
+	}
+	sort.Strings(keys)
+	w.names(keys)
+}
+
+func (w *binaryWriter) metaMap(m map[string][]string) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	w.keys(keys, m == nil)
+	for _, key := range keys {
+		w.count(len(m[key]), m[key] == nil)
+		for _, value := range m[key] {
+			w.string(value)
+		}
+	}
+}
+
+func (w *binaryWriter) expectations(m map[string]Status) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	w.keys(keys, m == nil)
+	for _, key := range keys {
+		w.string(string(m[key]))
+	}
+}
+
+func (w *binaryWriter) stringMap(m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	w.keys(keys, m == nil)
+	for _, key := range keys {
+		w.string(m[key])
+	}
+}
+
+// binaryReader reads the parts of the binary encoding of Lists. Once an error
+// is found it is stored in err, and all further reads return zero values.
+type binaryReader struct {
+	data []byte
+	err  error
+}
+
+func (r *binaryReader) fail(msg string) {
+	if r.err == nil {
+		r.err = errors.New(msg)
+	}
+	r.data = nil
+}
+
+func (r *binaryReader) uint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail("Truncated or invalid integer")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *binaryReader) int() int64 {
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.fail("Truncated or invalid integer")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// length reads a length, checking that it is no longer than the remaining
+// data, as each element takes at least one byte.
+func (r *binaryReader) length() int {
+	n := r.uint()
+	if n > uint64(len(r.data)) {
+		r.fail("Length exceeds the remaining data")
+		return 0
+	}
+	return int(n)
+}
+
+func (r *binaryReader) string() string {
+	n := r.length()
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
+
+// count reads a length written by binaryWriter.count, returning -1 for nil.
+func (r *binaryReader) count() int {
+	n := r.uint()
+	if n > uint64(len(r.data))+1 {
+		r.fail("Length exceeds the remaining data")
+		return -1
+	}
+	return int(n) - 1
+}
+
+func (r *binaryReader) names() []string {
+	n := r.count()
+	if n < 0 {
+		return nil
+	}
+	out := make([]string, 0, n)
+	prev := ""
+	for i := 0; i < n && r.err == nil; i++ {
+		shared := r.uint()
+		if shared > uint64(len(prev)) {
+			r.fail("Shared prefix exceeds the previous name")
+			break
+		}
+		name := prev[:shared] + r.string()
+		out = append(out, name)
+		prev = name
+	}
+	return out
+}
+
+func (r *binaryReader) metaMap() map[string][]string {
+	keys := r.names()
+	if keys == nil {
+		return nil
+	}
+	out := make(map[string][]string, len(keys))
+	for _, key := range keys {
+		n := r.count()
+		if n < 0 {
+			out[key] = nil
+			continue
+		}
+		values := make([]string, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			values = append(values, r.string())
+		}
+		out[key] = values
+	}
+	return out
+}
+
+func (r *binaryReader) expectations() map[string]Status {
+	keys := r.names()
+	if keys == nil {
+		return nil
+	}
+	out := make(map[string]Status, len(keys))
+	for _, key := range keys {
+		out[key] = Status(r.string())
+	}
+	return out
+}
+
+func (r *binaryReader) stringMap() map[string]string {
+	keys := r.names()
+	if keys == nil {
+		return nil
+	}
+	out := make(map[string]string, len(keys))
+	for _, key := range keys {
+		out[key] = r.string()
+	}
+	return out
+}
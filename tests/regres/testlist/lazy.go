@@ -0,0 +1,66 @@
+// Copyright 2019 The SwiftShader Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testlist
+
+import (
+	"fmt"
+	"sync"
+)
+
+// LazyLists is a test list whose test files are only loaded when their group
+// is first requested. LazyLists is safe for concurrent use.
+type LazyLists struct {
+	idx    index
+	groups []lazyGroup
+}
+
+// lazyGroup is a single, possibly not yet loaded, group of a LazyLists.
+type lazyGroup struct {
+	once  sync.Once
+	group Group
+	err   error
+}
+
+// LoadLazy loads the test list json file, deferring the loading of each
+// group's test file until the group is requested with LazyLists.Group.
+func LoadLazy(root, jsonPath string) (LazyLists, error) {
+	idx, err := loadIndex(root, jsonPath, LoadOptions{})
+	if err != nil {
+		return LazyLists{}, err
+	}
+	return LazyLists{idx: idx, groups: make([]lazyGroup, len(idx.groups))}, nil
+}
+
+// Names returns the names of all the groups, in index order.
+func (ll *LazyLists) Names() []string {
+	out := make([]string, len(ll.idx.groups))
+	for i, g := range ll.idx.groups {
+		out[i] = g.Name
+	}
+	return out
+}
+
+// Group returns the first group with the given name, loading its test file if
+// it has not already been loaded.
+func (ll *LazyLists) Group(name string) (Group, error) {
+	for i, g := range ll.idx.groups {
+		if g.Name == name {
+			lg := &ll.groups[i]
+			lg.once.Do(func() { lg.group, lg.err = ll.idx.loadGroup(i) })
+			return lg.group, lg.err
+		}
+	}
+	return Group{}, fmt.Errorf("Group '%s' not found", name)
+}
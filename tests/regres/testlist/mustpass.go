@@ -0,0 +1,101 @@
+// Copyright 2019 The SwiftShader Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testlist
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"../cause"
+)
+
+// mustpassNode is an element of a dEQP mustpass XML file.
+type mustpassNode struct {
+	XMLName  xml.Name
+	Name     string         `xml:"name,attr"`
+	Children []mustpassNode `xml:",any"`
+}
+
+// LoadMustpassXML loads the tests of the dEQP mustpass XML file at xmlPath,
+// returning a Lists holding a single group of the given API. The full name
+// of each test is formed by joining the names of the nested TestSuite,
+// TestCase and Test elements with '.'. The group is named after the XML
+// file, and its File is relative to root.
+func LoadMustpassXML(root, xmlPath string, api API) (Lists, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, cause.Wrap(err, "Couldn't get absolute path of '%s'", root)
+	}
+	xmlPath, err = filepath.Abs(xmlPath)
+	if err != nil {
+		return nil, cause.Wrap(err, "Couldn't get absolute path of '%s'", xmlPath)
+	}
+
+	data, err := ioutil.ReadFile(xmlPath)
+	if err != nil {
+		return nil, cause.Wrap(err, "Couldn't read '%s'", xmlPath)
+	}
+	var node mustpassNode
+	if err := xml.Unmarshal(data, &node); err != nil {
+		return nil, cause.Wrap(err, "Couldn't parse '%s'", xmlPath)
+	}
+
+	relPath, err := filepath.Rel(root, xmlPath)
+	if err != nil {
+		return nil, cause.Wrap(err, "Couldn't get relative path for '%s'", xmlPath)
+	}
+	group := Group{
+		Name: strings.TrimSuffix(filepath.Base(xmlPath), filepath.Ext(xmlPath)),
+		File: relPath,
+		API:  api,
+	}
+	if err := node.collect(nil, &group.Tests); err != nil {
+		return nil, cause.Wrap(err, "Invalid mustpass file '%s'", xmlPath)
+	}
+	group.Tests = Canonicalizer(nil).dedup(group.Tests)
+	return Lists{group}, nil
+}
+
+// collect appends the full names of all the tests at or below n to tests.
+// path holds the names of the enclosing elements.
+func (n mustpassNode) collect(path []string, tests *[]string) error {
+	switch n.XMLName.Local {
+	case "TestSuite", "TestCase", "Test":
+		if n.Name == "" {
+			return fmt.Errorf("%s element without a name below '%s'", n.XMLName.Local, strings.Join(path, "."))
+		}
+		path = append(path[:len(path):len(path)], n.Name)
+	}
+	isLeaf := true
+	for _, child := range n.Children {
+		switch child.XMLName.Local {
+		case "TestSuite", "TestCase", "Test":
+			isLeaf = false
+		}
+		if err := child.collect(path, tests); err != nil {
+			return err
+		}
+	}
+	switch n.XMLName.Local {
+	case "TestCase", "Test":
+		if isLeaf {
+			*tests = append(*tests, strings.Join(path, "."))
+		}
+	}
+	return nil
+}
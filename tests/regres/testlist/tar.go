@@ -0,0 +1,154 @@
+// Copyright 2019 The SwiftShader Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testlist
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"../cause"
+)
+
+var (
+	// ErrCorruptBundle is the kind of error returned by LoadTar and LoadBundle
+	// when the archive cannot be decompressed or read. Use errors.Is to test
+	// for it.
+	ErrCorruptBundle = errors.New("Corrupt test list archive")
+
+	// ErrNoIndex is the kind of error returned by LoadTar and LoadBundle when
+	// the archive does not hold the test list json file. Use errors.Is to test
+	// for it.
+	ErrNoIndex = errors.New("Test list not found in archive")
+)
+
+// bundleError is an error of the kind ErrCorruptBundle or ErrNoIndex.
+type bundleError struct {
+	kind error
+	msg  string
+}
+
+func (e bundleError) Error() string { return e.msg }
+func (e bundleError) Unwrap() error { return e.kind }
+
+// wrapBundleError returns an error of the given kind, with the message of
+// cause.Wrap(err, msg, args...), or just msg if err is nil.
+func wrapBundleError(kind, err error, msg string, args ...interface{}) error {
+	if err == nil {
+		return bundleError{kind, fmt.Sprintf(msg, args...)}
+	}
+	return bundleError{kind, cause.Wrap(err, msg, args...).Error()}
+}
+
+// LoadTar loads the test list json file named indexName from the tar archive
+// read from r, and returns the full set of tests. Test files referenced by the
+// index are resolved relative to the index's directory within the archive.
+// Group.File holds the path of the test file within the archive. Errors for a
+// corrupt archive or a missing index are of the kinds ErrCorruptBundle and
+// ErrNoIndex.
+func LoadTar(r io.Reader, indexName string) (Lists, error) {
+	files := map[string][]byte{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, wrapBundleError(ErrCorruptBundle, err, "Couldn't read tar archive")
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, wrapBundleError(ErrCorruptBundle, err, "Couldn't read '%s' from tar archive", hdr.Name)
+		}
+		files[path.Clean(hdr.Name)] = data
+	}
+
+	indexName = path.Clean(indexName)
+	data, ok := files[indexName]
+	if !ok {
+		return nil, wrapBundleError(ErrNoIndex, nil, "Couldn't find test list '%s' in tar archive", indexName)
+	}
+	jsonGroups, err := parseIndex(data, indexName, LoadOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	dir := path.Dir(indexName)
+	out := make(Lists, len(jsonGroups))
+	for i, jsonGroup := range jsonGroups {
+		group, err := jsonGroup.newGroup()
+		if err != nil {
+			return nil, err
+		}
+		tests := jsonGroup.inlineTests()
+		if !jsonGroup.isInline() {
+			group.File = path.Join(dir, jsonGroup.TestFile)
+			if tests, ok = files[group.File]; !ok {
+				return nil, fmt.Errorf("Couldn't find test file '%s' in tar archive", group.File)
+			}
+		}
+		if err := group.parse(tests, LoadOptions{}); err != nil {
+			return nil, err
+		}
+		out[i] = group
+	}
+
+	return out, nil
+}
+
+// BundleIndexName is the name of the test list json file within a bundle.
+const BundleIndexName = "index.json"
+
+// LoadBundle loads the test lists from the gzip compressed tar archive at
+// bundlePath. The archive must have a '.tar.gz' or '.tgz' extension, and must
+// hold the test list json file BundleIndexName at its root. Errors for a
+// corrupt archive or a missing index are of the kinds ErrCorruptBundle and
+// ErrNoIndex.
+func LoadBundle(bundlePath string) (Lists, error) {
+	if !strings.HasSuffix(bundlePath, ".tar.gz") && !strings.HasSuffix(bundlePath, ".tgz") {
+		return nil, fmt.Errorf("'%s' is not a .tar.gz bundle", bundlePath)
+	}
+
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return nil, cause.Wrap(err, "Couldn't open bundle '%s'", bundlePath)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, wrapBundleError(ErrCorruptBundle, err, "Couldn't decompress bundle '%s'", bundlePath)
+	}
+	defer gz.Close()
+
+	lists, err := LoadTar(gz, BundleIndexName)
+	if be, ok := err.(bundleError); ok {
+		return nil, wrapBundleError(be.kind, err, "Couldn't load bundle '%s'", bundlePath)
+	}
+	if err != nil {
+		return nil, cause.Wrap(err, "Couldn't load bundle '%s'", bundlePath)
+	}
+	return lists, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 The SwiftShader Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testlist
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// bundle returns a gzip compressed tar archive holding the given files.
+func bundle(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0666, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("Couldn't write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("Couldn't write tar content: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Couldn't close tar writer: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Couldn't close gzip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestLoadBundleErrors(t *testing.T) {
+	valid := bundle(t, map[string]string{
+		BundleIndexName: `[{"name": "vk", "api": "vulkan", "tests": "vk.txt"}]`,
+		"vk.txt":        "dEQP-VK.a\n",
+	})
+	for _, test := range []struct {
+		name    string
+		content []byte
+		want    error
+	}{
+		{"valid", valid, nil},
+		{"no index", bundle(t, map[string]string{"vk.txt": "dEQP-VK.a\n"}), ErrNoIndex},
+		{"not gzip", []byte("not a bundle"), ErrCorruptBundle},
+		{"truncated", valid[:len(valid)/2], ErrCorruptBundle},
+	} {
+		dir := tempDir(t, nil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "bundle.tar.gz")
+		if err := ioutil.WriteFile(path, test.content, 0666); err != nil {
+			t.Fatalf("Couldn't write '%s': %v", path, err)
+		}
+		_, err := LoadBundle(path)
+		switch {
+		case test.want == nil && err != nil:
+			t.Errorf("%s: LoadBundle returned error: %v", test.name, err)
+		case test.want != nil && !errors.Is(err, test.want):
+			t.Errorf("%s: LoadBundle returned error '%v', want kind '%v'", test.name, err, test.want)
+		}
+	}
+}
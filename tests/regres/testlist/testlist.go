@@ -16,15 +16,23 @@
 package testlist
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto/sha1"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"../cause"
 )
@@ -40,135 +48,2950 @@ const (
 	Vulkan = API("vulkan")
 )
 
+// Family returns the name of the family of the API: "gl" for EGL, GLES2 and
+// GLES3, "vulkan" for Vulkan, and "other" for any other API.
+func (a API) Family() string {
+	switch a {
+	case EGL, GLES2, GLES3:
+		return "gl"
+	case Vulkan:
+		return "vulkan"
+	default:
+		return "other"
+	}
+}
+
 // Group is a list of tests to be run for a single API.
 type Group struct {
 	Name  string
 	File  string
 	API   API
 	Tests []string
+	// Platforms maps a test name to the platforms it is restricted to.
+	// Tests without an entry, or with an empty entry, run on all platforms.
+	Platforms map[string][]string
+	// Flags maps a test name to the flags parsed from a columnar test file.
+	Flags map[string][]string
+	// After maps a test name to the tests that must be run before it.
+	After map[string][]string
+	// Expectations maps a test name to its expected status, parsed from an
+	// '[expect:<status>]' annotation. Statuses that are not one of Statuses,
+	// such as 'SKIP', are kept as written, with a warning.
+	Expectations map[string]Status
+	// Disabled is the sorted list of tests that are disabled with a
+	// '# DISABLED <test>' comment.
+	Disabled []string
+	// Timeout is the per-test timeout for the group's tests, or zero if the
+	// group does not specify a timeout.
+	Timeout time.Duration
+	// Meta holds arbitrary key-value annotations of the group.
+	Meta map[string]string
+}
+
+// Load loads the test list file and appends all tests to the Group.
+// If the file begins with a '# api: <api>' directive, and the Group has no
+// API, then the Group's API is set to the directive's API. An error is
+// returned if the directive conflicts with the Group's API.
+func (g *Group) Load() error {
+	return g.load(LoadOptions{})
+}
+
+func (g *Group) load(opts LoadOptions) error {
+	tests, err := ioutil.ReadFile(g.File)
+	if err != nil {
+		return cause.Wrap(err, "Couldn't read '%s'", g.File)
+	}
+	return g.parse(tests, opts)
+}
+
+// disabledPrefix is the prefix of a comment line that disables a test.
+const disabledPrefix = "# DISABLED "
+
+// utf8BOM is the UTF-8 byte order mark, which some editors write to the start
+// of text files.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// parse parses the content of a test list file, appending all tests to the
+// Group.
+func (g *Group) parse(tests []byte, opts LoadOptions) error {
+	p := newLineParser(*g, opts)
+	for _, line := range strings.Split(string(tests), "\n") {
+		t, err := p.parse(line)
+		if err != nil {
+			return err
+		}
+		if msg := p.warning(t); msg != "" {
+			opts.warn("%s", msg)
+		}
+		g.add(t)
+	}
+	g.API = p.api
+	sort.Strings(g.Tests)
+	sort.Strings(g.Disabled)
+	return nil
+}
+
+// add adds the test of the parsed line, if any, to the group.
+func (g *Group) add(t testLine) {
+	switch {
+	case t.disabled:
+		g.Disabled = append(g.Disabled, t.name)
+	case t.test:
+		if t.a.platforms != nil {
+			setMeta(&g.Platforms, t.name, t.a.platforms)
+		}
+		if t.a.expectation != "" {
+			if g.Expectations == nil {
+				g.Expectations = map[string]Status{}
+			}
+			g.Expectations[t.name] = t.a.expectation
+		}
+		if t.flags != nil {
+			setMeta(&g.Flags, t.name, t.flags)
+		}
+		if t.after != nil {
+			setMeta(&g.After, t.name, t.after)
+		}
+		g.Tests = append(g.Tests, t.name)
+	}
+}
+
+// testLine is a single parsed line of a test list file.
+type testLine struct {
+	test     bool   // true if the line holds a test
+	disabled bool   // true if the line disables a test
+	name     string // name of the test or disabled test
+	a        annotations
+	flags    []string
+	after    []string
+}
+
+// lineParser parses the lines of a single test list file, in order, holding
+// the state carried between lines. Both Group.parse and Verify use it, so
+// that they parse test files identically.
+type lineParser struct {
+	file     string // path of the test file, used for messages
+	group    string // name of the group, used for messages
+	api      API    // API of the group, possibly set by an '# api:' directive
+	opts     LoadOptions
+	started  bool // true once the first line has been parsed
+	inHeader bool // true until the first test line
+}
+
+// newLineParser returns a lineParser for the test file of the group.
+func newLineParser(g Group, opts LoadOptions) *lineParser {
+	return &lineParser{file: g.File, group: g.Name, api: g.API, opts: opts, inHeader: true}
+}
+
+// parse parses the next line of the test file. A leading UTF-8 BOM is removed
+// from the first line. If the file begins with a '# api: <api>' directive and
+// the group has no API, then the directive's API becomes the group's API. An
+// error is returned if the directive conflicts with the group's API.
+func (p *lineParser) parse(line string) (testLine, error) {
+	if !p.started {
+		p.started = true
+		line = strings.TrimPrefix(line, string(utf8BOM))
+	}
+	line = strings.TrimSpace(line)
+	if p.opts.ParseDisabled && strings.HasPrefix(line, disabledPrefix) {
+		name := strings.TrimSpace(line[len(disabledPrefix):])
+		return testLine{disabled: name != "", name: name}, nil
+	}
+	if p.inHeader && strings.HasPrefix(line, "#") {
+		if api, ok := parseAPIDirective(line); ok {
+			switch {
+			case p.api == "":
+				p.api = api
+			case p.api != api:
+				return testLine{}, fmt.Errorf("'%s' declares API '%s', but group '%s' has API '%s'",
+					p.file, api, p.group, p.api)
+			}
+		}
+		return testLine{}, nil
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return testLine{}, nil
+	}
+	p.inHeader = false
+	t := testLine{test: true}
+	if p.opts.Columnar {
+		line, t.flags = parseFlags(line)
+	}
+	if p.opts.OrderHints {
+		line, t.after = parseOrderHints(line)
+	}
+	t.name, t.a = parseAnnotations(line)
+	return t, nil
+}
+
+// warning returns a message describing a non-fatal problem with the parsed
+// line, or an empty string if there is none.
+func (p *lineParser) warning(t testLine) string {
+	if t.test && t.a.expectation != "" && !t.a.expectation.valid() {
+		return fmt.Sprintf("'%s' has unknown expectation '%s' for test '%s'", p.file, t.a.expectation, t.name)
+	}
+	return ""
+}
+
+// rename renames the tests found in renames, then sorts and deduplicates the
+// tests.
+func (g *Group) rename(renames map[string]string) {
+	out := Group{Name: g.Name, File: g.File, API: g.API}
+	seen := map[string]bool{}
+	for _, test := range g.Tests {
+		name, ok := renames[test]
+		if !ok {
+			name = test
+		}
+		if !seen[name] {
+			seen[name] = true
+			out.Tests = append(out.Tests, name)
+		}
+		g.copyTestMeta(&out, test, name)
+	}
+	sort.Strings(out.Tests)
+	g.Tests, g.Platforms, g.Flags, g.After = out.Tests, out.Platforms, out.Flags, out.After
+	g.Expectations = out.Expectations
+}
+
+// testMeta returns a string describing all the per-test metadata of test,
+// used to compare the metadata of tests.
+func (g Group) testMeta(test string) string {
+	return fmt.Sprintf("platforms:%q flags:%q after:%q expect:%q",
+		g.Platforms[test], g.Flags[test], g.After[test], g.Expectations[test])
+}
+
+// clearTestMeta removes all the per-test metadata of test.
+func (g *Group) clearTestMeta(test string) {
+	delete(g.Platforms, test)
+	delete(g.Flags, test)
+	delete(g.After, test)
+	delete(g.Expectations, test)
+}
+
+// setMeta sets (*m)[test] to value, allocating the map if necessary.
+func setMeta(m *map[string][]string, test string, value []string) {
+	if *m == nil {
+		*m = map[string][]string{}
+	}
+	(*m)[test] = value
+}
+
+// copyTestMeta copies the per-test metadata of the test named from in g to
+// the test named to in out. Metadata that out already holds for to is not
+// replaced.
+func (g Group) copyTestMeta(out *Group, from, to string) {
+	if platforms, ok := g.Platforms[from]; ok {
+		if _, exists := out.Platforms[to]; !exists {
+			setMeta(&out.Platforms, to, platforms)
+		}
+	}
+	if flags, ok := g.Flags[from]; ok {
+		if _, exists := out.Flags[to]; !exists {
+			setMeta(&out.Flags, to, flags)
+		}
+	}
+	if after, ok := g.After[from]; ok {
+		if _, exists := out.After[to]; !exists {
+			setMeta(&out.After, to, after)
+		}
+	}
+	if status, ok := g.Expectations[from]; ok {
+		if _, exists := out.Expectations[to]; !exists {
+			if out.Expectations == nil {
+				out.Expectations = map[string]Status{}
+			}
+			out.Expectations[to] = status
+		}
+	}
+}
+
+// parseAPIDirective parses a test list comment line of the form '# api: <api>',
+// returning the API and true if the line is an API directive.
+func parseAPIDirective(line string) (API, bool) {
+	line = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+	const prefix = "api:"
+	if !strings.HasPrefix(line, prefix) {
+		return "", false
+	}
+	return API(strings.TrimSpace(line[len(prefix):])), true
+}
+
+// parseFlags splits a columnar test list line of the form
+// 'dEQP-VK.foo<tab>flag1,flag2' into the test name and the list of flags. If
+// the line has no tab then the line is returned unaltered with a nil flag
+// list.
+func parseFlags(line string) (string, []string) {
+	idx := strings.Index(line, "\t")
+	if idx < 0 {
+		return line, nil
+	}
+	flags := []string{}
+	for _, f := range strings.Split(line[idx+1:], ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			flags = append(flags, f)
+		}
+	}
+	return strings.TrimSpace(line[:idx]), flags
+}
+
+// parseOrderHints splits a test list line of the form
+// 'dEQP-VK.foo after:dEQP-VK.bar after:dEQP-VK.baz' into the line without the
+// hints and the list of tests named by the hints. If the line has no ordering
+// hints then the line is returned unaltered with a nil list.
+func parseOrderHints(line string) (string, []string) {
+	const prefix = "after:"
+	var after []string
+	for {
+		idx := strings.LastIndex(line, " "+prefix)
+		if idx < 0 {
+			break
+		}
+		test := strings.TrimSpace(line[idx+1+len(prefix):])
+		if test == "" || strings.ContainsAny(test, " \t") {
+			break
+		}
+		after = append([]string{test}, after...)
+		line = strings.TrimSpace(line[:idx])
+	}
+	return line, after
+}
+
+// annotations holds the annotations parsed from a test list line.
+type annotations struct {
+	platforms   []string // from '[platform:linux,android]'
+	expectation Status   // from '[expect:FAIL]'
+}
+
+// parseAnnotations splits a test list line of the form
+// 'dEQP-VK.foo [platform:linux,android] [expect:FAIL]' into the test name and
+// its annotations. Annotations may be given in any order. If the line has no
+// annotations then the line is returned unaltered with empty annotations. A
+// platform annotation without any platforms, such as '[platform:]', is removed
+// from the name but places no restriction on the test.
+func parseAnnotations(line string) (string, annotations) {
+	a := annotations{}
+	for strings.HasSuffix(line, "]") {
+		idx := strings.LastIndex(line, "[")
+		if idx < 0 {
+			break
+		}
+		parts := strings.SplitN(line[idx+1:len(line)-1], ":", 2)
+		if len(parts) != 2 {
+			break
+		}
+		switch parts[0] {
+		case "platform":
+			// An empty platform list places no restriction on the test.
+			a.platforms = nil
+			for _, p := range strings.Split(parts[1], ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					a.platforms = append(a.platforms, p)
+				}
+			}
+		case "expect":
+			a.expectation = Status(strings.TrimSpace(parts[1]))
+		default:
+			return line, a
+		}
+		line = strings.TrimSpace(line[:idx])
+	}
+	return line, a
+}
+
+// expectation returns the expected status of the test, or NoExpectation if the
+// test has no expectation.
+func (g Group) expectation(test string) string {
+	if status, ok := g.Expectations[test]; ok {
+		return string(status)
+	}
+	return NoExpectation
+}
+
+// RunsOn returns true if the test may be run on the given platform.
+func (g Group) RunsOn(test, platform string) bool {
+	platforms := g.Platforms[test]
+	if len(platforms) == 0 {
+		return true
+	}
+	for _, p := range platforms {
+		if p == platform {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns a new Group that contains only tests that match the predicate.
+func (g Group) Filter(pred func(string) bool) Group {
+	out := Group{
+		Name:     g.Name,
+		File:     g.File,
+		API:      g.API,
+		Disabled: g.Disabled,
+		Timeout:  g.Timeout,
+		Meta:     g.Meta,
+	}
+	for _, test := range g.Tests {
+		if pred(test) {
+			out.Tests = append(out.Tests, test)
+			g.copyTestMeta(&out, test, test)
+		}
+	}
+	return out
+}
+
+// SortedBy returns a copy of the group's tests, sorted by the less function.
+// The group itself is not modified.
+func (g Group) SortedBy(less func(a, b string) bool) []string {
+	out := make([]string, len(g.Tests))
+	copy(out, g.Tests)
+	sort.SliceStable(out, func(i, j int) bool { return less(out[i], out[j]) })
+	return out
+}
+
+// Seeds returns a seed for each test of the group, keyed by test name. Each
+// seed is the first 8 bytes, big-endian, of the SHA1 hash of the salt, API and
+// test name, each followed by a zero byte. The seeds only depend on these
+// inputs, so are stable across runs, platforms and Go versions.
+func (g Group) Seeds(salt string) map[string]uint64 {
+	out := make(map[string]uint64, len(g.Tests))
+	for _, test := range g.Tests {
+		h := sha1.New()
+		for _, s := range []string{salt, string(g.API), test} {
+			h.Write([]byte(s))
+			h.Write([]byte{0})
+		}
+		out[test] = binary.BigEndian.Uint64(h.Sum(nil))
+	}
+	return out
+}
+
+// ExpandTemplates returns a copy of the group where each test name holding
+// brace enclosed, comma separated alternatives, such as
+// 'dEQP-VK.foo.{r8,rg8,rgba8}', is replaced with the names formed from each
+// of the alternatives. Names with more than one brace group are expanded into
+// every combination of the alternatives. Expanded tests inherit the metadata
+// of their template. The tests are sorted and deduplicated. An error is
+// returned if a name has unbalanced or nested braces.
+func (g Group) ExpandTemplates() (Group, error) {
+	out := g.Filter(func(string) bool { return false })
+	for _, test := range g.Tests {
+		expanded, err := expandTemplate(test)
+		if err != nil {
+			return Group{}, cause.Wrap(err, "Couldn't expand test '%s' of group '%s'", test, g.Name)
+		}
+		for _, name := range expanded {
+			out.Tests = append(out.Tests, name)
+			g.copyTestMeta(&out, test, name)
+		}
+	}
+	out.Tests = Canonicalizer(nil).dedup(out.Tests)
+	return out, nil
+}
+
+// expandTemplate returns all the names formed by replacing each brace group in
+// the template with one of its comma separated alternatives.
+func expandTemplate(template string) ([]string, error) {
+	open := strings.IndexAny(template, "{}")
+	if open < 0 {
+		return []string{template}, nil
+	}
+	if template[open] == '}' {
+		return nil, fmt.Errorf("Unexpected '}'")
+	}
+	end := strings.IndexAny(template[open+1:], "{}")
+	if end < 0 {
+		return nil, fmt.Errorf("Unclosed '{'")
+	}
+	end += open + 1
+	if template[end] == '{' {
+		return nil, fmt.Errorf("Nested '{'")
+	}
+	suffixes, err := expandTemplate(template[end+1:])
+	if err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, alt := range strings.Split(template[open+1:end], ",") {
+		for _, suffix := range suffixes {
+			out = append(out, template[:open]+alt+suffix)
+		}
+	}
+	return out, nil
+}
+
+// Limit returns a new Group that contains a maximum of limit tests.
+func (g Group) Limit(limit int) Group {
+	out := Group{
+		Name:         g.Name,
+		File:         g.File,
+		API:          g.API,
+		Tests:        g.Tests,
+		Platforms:    g.Platforms,
+		Flags:        g.Flags,
+		After:        g.After,
+		Expectations: g.Expectations,
+		Disabled:     g.Disabled,
+		Timeout:      g.Timeout,
+		Meta:         g.Meta,
+	}
+	if len(g.Tests) > limit {
+		out.Tests = g.Tests[:limit]
+	}
+	return out
+}
+
+// Write writes the group's tests to w in the test list file format, one test
+// per line, such that they can be loaded again with Load. An error is returned
+// if a test name cannot be written without being misparsed on reload, or if a
+// test has flags or ordering hints, as Load does not parse them.
+func (g Group) Write(w io.Writer) error {
+	return g.WriteWithOptions(w, LoadOptions{})
+}
+
+// WriteWithOptions is like Write, except that the tests are written such that
+// they can be loaded again with the given options. Tests with flags are written
+// in the columnar format, and so require opts.Columnar. Tests with ordering
+// hints require opts.OrderHints. If opts.ParseDisabled is set, the group's
+// disabled tests are also written.
+func (g Group) WriteWithOptions(w io.Writer, opts LoadOptions) error {
+	for _, test := range g.Tests {
+		if err := checkWritable(test, opts); err != nil {
+			return err
+		}
+		line := test
+		if platforms := g.Platforms[test]; len(platforms) > 0 {
+			line += " [platform:" + strings.Join(platforms, ",") + "]"
+		}
+		if status, ok := g.Expectations[test]; ok {
+			line += " [expect:" + string(status) + "]"
+		}
+		if after := g.After[test]; len(after) > 0 {
+			if !opts.OrderHints {
+				return fmt.Errorf("Cannot write ordering hints of test '%s' without LoadOptions.OrderHints", test)
+			}
+			for _, dep := range after {
+				if dep == "" || strings.ContainsAny(dep, " \t\r\n") {
+					return fmt.Errorf("Cannot write ordering hint '%s' of test '%s'", dep, test)
+				}
+				line += " after:" + dep
+			}
+		}
+		if flags := g.Flags[test]; len(flags) > 0 {
+			if !opts.Columnar {
+				return fmt.Errorf("Cannot write flags of test '%s' without LoadOptions.Columnar", test)
+			}
+			for _, flag := range flags {
+				if flag == "" || strings.TrimSpace(flag) != flag || strings.ContainsAny(flag, ",\t\r\n") {
+					return fmt.Errorf("Cannot write flag '%s' of test '%s'", flag, test)
+				}
+			}
+			line += "\t" + strings.Join(flags, ",")
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return cause.Wrap(err, "Couldn't write test list for '%s'", g.Name)
+		}
+	}
+	if opts.ParseDisabled {
+		for _, test := range g.Disabled {
+			if err := checkWritable(test, opts); err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintln(w, disabledPrefix+test); err != nil {
+				return cause.Wrap(err, "Couldn't write test list for '%s'", g.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// checkWritable returns an error if the test name would not survive a round
+// trip through WriteWithOptions and LoadWithOptions with the given options.
+// Names may contain '#', as long as it is not the first character, as the line
+// would otherwise be parsed as a comment.
+func checkWritable(test string, opts LoadOptions) error {
+	switch {
+	case test == "":
+		return fmt.Errorf("Cannot write empty test name")
+	case strings.TrimSpace(test) != test:
+		return fmt.Errorf("Cannot write test name '%s' with leading or trailing whitespace", test)
+	case strings.ContainsAny(test, "\r\n"):
+		return fmt.Errorf("Cannot write test name '%s' containing a newline", test)
+	case strings.HasPrefix(test, "#"):
+		return fmt.Errorf("Cannot write test name '%s' as it would be parsed as a comment", test)
+	case opts.Columnar && strings.Contains(test, "\t"):
+		return fmt.Errorf("Cannot write test name '%s' as it would be parsed as a flag column", test)
+	}
+	if opts.OrderHints {
+		if _, after := parseOrderHints(test); after != nil {
+			return fmt.Errorf("Cannot write test name '%s' as it would be parsed as an ordering hint", test)
+		}
+	}
+	if name, _ := parseAnnotations(test); name != test {
+		return fmt.Errorf("Cannot write test name '%s' as it would be parsed as an annotation", test)
+	}
+	return nil
+}
+
+// TopoOrder returns the group's tests ordered so that each test comes after
+// all the tests it must be run after, as declared by Group.After. Tests that
+// are otherwise unordered are returned in sorted order, so a group without
+// ordering hints returns its tests sorted. Hints naming tests that are not in
+// the group are ignored. An error is returned if the hints form a cycle.
+func (g Group) TopoOrder() ([]string, error) {
+	tests := Canonicalizer(nil).dedup(g.Tests)
+	inGroup := map[string]bool{}
+	for _, test := range tests {
+		inGroup[test] = true
+	}
+
+	pending := map[string]int{}         // test -> number of unrun dependencies
+	dependents := map[string][]string{} // test -> tests that depend on it
+	for _, test := range tests {
+		for _, dep := range g.After[test] {
+			if inGroup[dep] && dep != test {
+				pending[test]++
+				dependents[dep] = append(dependents[dep], test)
+			}
+		}
+	}
+
+	ready := []string{}
+	for _, test := range tests {
+		if pending[test] == 0 {
+			ready = append(ready, test)
+		}
+	}
+
+	out := make([]string, 0, len(tests))
+	for len(ready) > 0 {
+		test := ready[0]
+		ready = ready[1:]
+		out = append(out, test)
+		added := false
+		for _, dependent := range dependents[test] {
+			if pending[dependent]--; pending[dependent] == 0 {
+				ready = append(ready, dependent)
+				added = true
+			}
+		}
+		if added {
+			sort.Strings(ready)
+		}
+	}
+
+	if len(out) != len(tests) {
+		cyclic := []string{}
+		for _, test := range tests {
+			if pending[test] > 0 {
+				cyclic = append(cyclic, test)
+			}
+		}
+		return nil, fmt.Errorf("Group '%s' has a cycle in the test ordering involving: %s",
+			g.Name, strings.Join(cyclic, ", "))
+	}
+	return out, nil
+}
+
+// AppendToFile adds tests to the group's test file, found relative to root.
+// The file's existing tests and the new tests are sorted and deduplicated.
+// Comments before the first test and after the last test are kept in place,
+// and any other comments are kept immediately before the test that follows
+// them. The file is written to a temporary file which is then renamed over
+// the original, so the test file is never left partially written.
+func (g Group) AppendToFile(root string, tests []string) error {
+	if g.File == "" {
+		return fmt.Errorf("Group '%s' has no test file", g.Name)
+	}
+	// The test file is parsed below with both flags and ordering hints, so
+	// reject any name that either would misparse.
+	writable := LoadOptions{Columnar: true, OrderHints: true}
+	for _, test := range tests {
+		if err := checkWritable(test, writable); err != nil {
+			return err
+		}
+	}
+
+	path := filepath.Join(root, g.File)
+	info, err := os.Stat(path)
+	if err != nil {
+		return cause.Wrap(err, "Couldn't stat '%s'", path)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cause.Wrap(err, "Couldn't read '%s'", path)
+	}
+	content = bytes.TrimPrefix(content, utf8BOM)
+
+	type entry struct {
+		name     string
+		comments []string // lines preceding the test
+		line     string
+	}
+	header, pending := []string{}, []string{}
+	entries := []entry{}
+	lines := []string{}
+	if text := strings.TrimRight(string(content), "\n"); text != "" {
+		lines = strings.Split(text, "\n")
+	}
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			if len(entries) == 0 {
+				header = append(header, line)
+			} else {
+				pending = append(pending, line)
+			}
+			continue
+		}
+		name, _ := parseFlags(trimmed)
+		name, _ = parseOrderHints(name)
+		name, _ = parseAnnotations(name)
+		entries = append(entries, entry{name, pending, trimmed})
+		pending = []string{}
+	}
+	for _, test := range tests {
+		entries = append(entries, entry{name: test, line: test})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	buf := bytes.Buffer{}
+	for _, line := range header {
+		fmt.Fprintln(&buf, line)
+	}
+	for i, e := range entries {
+		if i > 0 && entries[i-1].name == e.name {
+			continue
+		}
+		for _, line := range e.comments {
+			fmt.Fprintln(&buf, line)
+		}
+		fmt.Fprintln(&buf, e.line)
+	}
+	for _, line := range pending {
+		fmt.Fprintln(&buf, line)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return cause.Wrap(err, "Couldn't create temporary file for '%s'", path)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return cause.Wrap(err, "Couldn't write '%s'", tmp.Name())
+	}
+	if err := tmp.Close(); err != nil {
+		return cause.Wrap(err, "Couldn't write '%s'", tmp.Name())
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+		return cause.Wrap(err, "Couldn't set permissions of '%s'", tmp.Name())
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return cause.Wrap(err, "Couldn't replace '%s'", path)
+	}
+	return nil
+}
+
+// hashGroup is the form of a Group that is encoded to produce hashes. Unlike
+// Group, it holds no maps, so its encoding is deterministic.
+type hashGroup struct {
+	Name     string
+	File     string
+	API      API
+	Tests    []string
+	Disabled []string
+	Timeout  time.Duration
+	Meta     [][]string
+}
+
+// hashable returns the group as a hashGroup. Meta holds an entry of the form
+// [kind, test, values...] for each per-test metadata entry, sorted by kind
+// then test, followed by a ["meta", key, value] entry for each of the group's
+// Meta annotations, sorted by key.
+func (g Group) hashable() hashGroup {
+	out := hashGroup{
+		Name:     g.Name,
+		File:     g.File,
+		API:      g.API,
+		Tests:    g.Tests,
+		Disabled: g.Disabled,
+		Timeout:  g.Timeout,
+	}
+	for _, meta := range []struct {
+		kind string
+		m    map[string][]string
+	}{
+		{"after", g.After},
+		{"flags", g.Flags},
+		{"platforms", g.Platforms},
+	} {
+		tests := make([]string, 0, len(meta.m))
+		for test := range meta.m {
+			tests = append(tests, test)
+		}
+		sort.Strings(tests)
+		for _, test := range tests {
+			out.Meta = append(out.Meta, append([]string{meta.kind, test}, meta.m[test]...))
+		}
+	}
+	tests := make([]string, 0, len(g.Expectations))
+	for test := range g.Expectations {
+		tests = append(tests, test)
+	}
+	sort.Strings(tests)
+	for _, test := range tests {
+		out.Meta = append(out.Meta, []string{"expect", test, string(g.Expectations[test])})
+	}
+	keys := make([]string, 0, len(g.Meta))
+	for key := range g.Meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		out.Meta = append(out.Meta, []string{"meta", key, g.Meta[key]})
+	}
+	return out
+}
+
+// CacheKey returns a SHA1 hash of the group.
+func (g Group) CacheKey() string {
+	h := sha1.New()
+	if err := gob.NewEncoder(h).Encode(g.hashable()); err != nil {
+		panic(cause.Wrap(err, "Could not encode group to produce hash"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Lists is the full list of tests to be run.
+// Lists implements sort.Interface, ordering groups by API then Name.
+type Lists []Group
+
+// Len returns the number of groups.
+func (l Lists) Len() int { return len(l) }
+
+// Less returns true if the i'th group sorts before the j'th group in the
+// canonical order, by API then Name.
+func (l Lists) Less(i, j int) bool {
+	if l[i].API != l[j].API {
+		return l[i].API < l[j].API
+	}
+	return l[i].Name < l[j].Name
+}
+
+// Swap swaps the i'th and j'th groups.
+func (l Lists) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+// Filter returns a new Lists that contains only tests that match the predicate.
+func (l Lists) Filter(pred func(string) bool) Lists {
+	out := Lists{}
+	for _, group := range l {
+		filtered := group.Filter(pred)
+		if len(filtered.Tests) > 0 {
+			out = append(out, filtered)
+		}
+	}
+	return out
+}
+
+// FilterPlatform returns a new Lists that contains only the tests that may be
+// run on the given platform. Tests without a platform annotation are always
+// kept.
+func (l Lists) FilterPlatform(platform string) Lists {
+	out := Lists{}
+	for _, group := range l {
+		filtered := group.Filter(func(test string) bool {
+			return group.RunsOn(test, platform)
+		})
+		if len(filtered.Tests) > 0 {
+			out = append(out, filtered)
+		}
+	}
+	return out
+}
+
+// Flatten returns a single Group with the given name that contains the sorted,
+// deduplicated union of all the tests in l. If every group in l shares the
+// same API then the returned Group uses that API, otherwise the API is left
+// empty. The returned Group has no File.
+func (l Lists) Flatten(name string) Group {
+	out := Group{Name: name}
+	seen := map[string]bool{}
+	for i, group := range l {
+		if i == 0 {
+			out.API = group.API
+		} else if out.API != group.API {
+			out.API = ""
+		}
+		for _, test := range group.Tests {
+			if seen[test] {
+				continue
+			}
+			seen[test] = true
+			out.Tests = append(out.Tests, test)
+			group.copyTestMeta(&out, test, test)
+		}
+	}
+	sort.Strings(out.Tests)
+	return out
+}
+
+// FindDuplicateGroupDefs returns a sorted list of descriptions of each group
+// that is defined more than once with the same Name and API, along with the
+// number of times it is defined.
+func (l Lists) FindDuplicateGroupDefs() []string {
+	type key struct {
+		name string
+		api  API
+	}
+	counts := map[key]int{}
+	for _, group := range l {
+		counts[key{group.Name, group.API}]++
+	}
+	out := []string{}
+	for k, count := range counts {
+		if count > 1 {
+			out = append(out, fmt.Sprintf("Group '%s' (%s) is defined %d times", k.name, k.api, count))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Hash returns a SHA1 hash of the set of tests.
+func (l Lists) Hash() string {
+	groups := make([]hashGroup, len(l))
+	for i, group := range l {
+		groups[i] = group.hashable()
+	}
+	h := sha1.New()
+	if err := gob.NewEncoder(h).Encode(groups); err != nil {
+		panic(cause.Wrap(err, "Could not encode testlist to produce hash"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ReplaceGroup returns a copy of l with the first group that has the same Name
+// and API as g replaced with g. If no such group exists, then l is returned
+// unaltered and false is returned. ReplaceGroup never appends g to the list.
+func (l Lists) ReplaceGroup(g Group) (Lists, bool) {
+	for i, group := range l {
+		if group.Name == g.Name && group.API == g.API {
+			out := make(Lists, len(l))
+			copy(out, l)
+			out[i] = g
+			return out, true
+		}
+	}
+	return l, false
+}
+
+// LargestGroups returns the n groups with the most tests, sorted by
+// descending number of tests, then by Name. If n is greater than the number of
+// groups, then all groups are returned.
+func (l Lists) LargestGroups(n int) []Group {
+	sorted := make([]Group, len(l))
+	copy(sorted, l)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if len(a.Tests) != len(b.Tests) {
+			return len(a.Tests) > len(b.Tests)
+		}
+		return a.Name < b.Name
+	})
+	if n < 0 {
+		n = 0
+	}
+	if n < len(sorted) {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// MarshalInlineJSON returns the lists encoded as a test list json file, with
+// each group's tests written inline in an "inline" field instead of being
+// referenced by file. The tests' platforms, expectations, flags and ordering
+// hints are written as inline annotations, and disabled tests as
+// '# DISABLED <test>' lines, so the result can be loaded again with
+// LoadWithOptions with Columnar, OrderHints and ParseDisabled set.
+func (l Lists) MarshalInlineJSON() ([]byte, error) {
+	type inlineGroup struct {
+		Name    string            `json:"name"`
+		API     string            `json:"api"`
+		Tests   []string          `json:"inline"`
+		Timeout string            `json:"timeout,omitempty"`
+		Meta    map[string]string `json:"meta,omitempty"`
+	}
+	opts := LoadOptions{Columnar: true, OrderHints: true, ParseDisabled: true}
+	groups := make([]inlineGroup, len(l))
+	for i, group := range l {
+		buf := bytes.Buffer{}
+		if err := group.WriteWithOptions(&buf, opts); err != nil {
+			return nil, err
+		}
+		tests := []string{}
+		if text := strings.TrimSuffix(buf.String(), "\n"); text != "" {
+			tests = strings.Split(text, "\n")
+		}
+		groups[i] = inlineGroup{Name: group.Name, API: string(group.API), Tests: tests, Meta: group.Meta}
+		if group.Timeout != 0 {
+			groups[i].Timeout = group.Timeout.String()
+		}
+	}
+	return json.MarshalIndent(groups, "", "  ")
+}
+
+// Select returns a new Lists containing the groups whose Name matches any of
+// names, preserving the order of l, along with the list of names that did not
+// match any group. If names is empty, then an empty Lists is returned.
+func (l Lists) Select(names ...string) (Lists, []string) {
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+	out := Lists{}
+	found := map[string]bool{}
+	for _, group := range l {
+		if wanted[group.Name] {
+			out = append(out, group)
+			found[group.Name] = true
+		}
+	}
+	var missing []string
+	for _, name := range names {
+		if !found[name] {
+			missing = append(missing, name)
+			found[name] = true
+		}
+	}
+	return out, missing
+}
+
+// testsByAPI returns the set of tests in l, keyed by API.
+func (l Lists) testsByAPI() map[API]map[string]bool {
+	out := map[API]map[string]bool{}
+	for _, group := range l {
+		set, ok := out[group.API]
+		if !ok {
+			set = map[string]bool{}
+			out[group.API] = set
+		}
+		for _, test := range group.Tests {
+			set[test] = true
+		}
+	}
+	return out
+}
+
+// DeadExcludes returns the tests in excludes that have no matching test in
+// includes for the same API. The tests for each API are sorted and
+// deduplicated. If every excluded test is included, then an empty map is
+// returned.
+func DeadExcludes(includes, excludes Lists) map[API][]string {
+	included := includes.testsByAPI()
+	out := map[API][]string{}
+	for api, tests := range excludes.testsByAPI() {
+		for test := range tests {
+			if !included[api][test] {
+				out[api] = append(out[api], test)
+			}
+		}
+	}
+	for _, tests := range out {
+		sort.Strings(tests)
+	}
+	return out
+}
+
+// DiffText returns a human readable diff of the tests in old and new. Tests are
+// grouped by API, with each API section beginning with an '@@ <api> @@'
+// header. Each line is of the form '+ <test>' for a test only found in new, or
+// '- <test>' for a test only found in old, sorted by test name. If old and new
+// contain the same tests, then an empty string is returned.
+func DiffText(old, new Lists) string {
+	oldTests, newTests := old.testsByAPI(), new.testsByAPI()
+	apis := map[API]bool{}
+	for api := range oldTests {
+		apis[api] = true
+	}
+	for api := range newTests {
+		apis[api] = true
+	}
+	sortedAPIs := make([]string, 0, len(apis))
+	for api := range apis {
+		sortedAPIs = append(sortedAPIs, string(api))
+	}
+	sort.Strings(sortedAPIs)
+
+	sb := strings.Builder{}
+	for _, api := range sortedAPIs {
+		type change struct {
+			test string
+			op   byte
+		}
+		changes := []change{}
+		for test := range oldTests[API(api)] {
+			if !newTests[API(api)][test] {
+				changes = append(changes, change{test, '-'})
+			}
+		}
+		for test := range newTests[API(api)] {
+			if !oldTests[API(api)][test] {
+				changes = append(changes, change{test, '+'})
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		sort.Slice(changes, func(i, j int) bool { return changes[i].test < changes[j].test })
+		fmt.Fprintf(&sb, "@@ %s @@\n", api)
+		for _, c := range changes {
+			fmt.Fprintf(&sb, "%c %s\n", c.op, c.test)
+		}
+	}
+	return sb.String()
+}
+
+// namePrefix returns the first depth '.' separated segments of the test name.
+// If the name has fewer than depth segments, then the whole name is returned.
+// A depth less than 1 is treated as 1.
+func namePrefix(test string, depth int) string {
+	if depth < 1 {
+		depth = 1
+	}
+	parts := strings.SplitN(test, ".", depth+1)
+	if len(parts) <= depth {
+		return test
+	}
+	return strings.Join(parts[:depth], ".")
+}
+
+// PrefixCounts returns the number of tests in l, keyed by the first depth '.'
+// separated segments of the test names. For example, with a depth of 2, all
+// the 'dEQP-VK.api.*' tests are counted under 'dEQP-VK.api'. Tests with fewer
+// than depth segments are counted under their full name. A depth less than 1
+// is treated as 1.
+func (l Lists) PrefixCounts(depth int) map[string]int {
+	out := map[string]int{}
+	for _, group := range l {
+		for _, test := range group.Tests {
+			out[namePrefix(test, depth)]++
+		}
+	}
+	return out
+}
+
+// Canonicalizer returns the canonical form of a test name. Test names with the
+// same canonical form are considered equal by Dedup, Merge, Intersect and
+// Subtract. A nil Canonicalizer keeps names as they are.
+type Canonicalizer func(string) string
+
+func (c Canonicalizer) canonical(test string) string {
+	if c == nil {
+		return test
+	}
+	return c(test)
+}
+
+// dedup returns the sorted tests, with all but the first seen spelling of each
+// canonical test name removed.
+func (c Canonicalizer) dedup(tests []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, test := range tests {
+		key := c.canonical(test)
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, test)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// dedupGroup returns a copy of g with all but the first seen spelling of each
+// canonical test name removed. The per-test metadata of each removed spelling
+// is moved to the kept spelling, where the kept spelling does not already have
+// that metadata.
+func (c Canonicalizer) dedupGroup(g Group) Group {
+	out := Group{
+		Name:     g.Name,
+		File:     g.File,
+		API:      g.API,
+		Tests:    []string{},
+		Disabled: g.Disabled,
+		Timeout:  g.Timeout,
+		Meta:     g.Meta,
+	}
+	kept := map[string]string{} // canonical name -> kept spelling
+	for _, test := range g.Tests {
+		key := c.canonical(test)
+		spelling, ok := kept[key]
+		if !ok {
+			kept[key], spelling = test, test
+			out.Tests = append(out.Tests, test)
+		}
+		g.copyTestMeta(&out, test, spelling)
+	}
+	sort.Strings(out.Tests)
+	return out
+}
+
+// keep returns a copy of g containing only the tests whose canonical name is
+// in set (or not in set if in is false).
+func (c Canonicalizer) keep(g Group, set map[string]bool, in bool) Group {
+	return g.Filter(func(test string) bool { return set[c.canonical(test)] == in })
+}
+
+// canonicalByAPI returns the set of the canonical test names in l, keyed by
+// API.
+func (c Canonicalizer) canonicalByAPI(l Lists) map[API]map[string]bool {
+	out := map[API]map[string]bool{}
+	for api, tests := range l.testsByAPI() {
+		set := map[string]bool{}
+		for test := range tests {
+			set[c.canonical(test)] = true
+		}
+		out[api] = set
+	}
+	return out
+}
+
+// Dedup returns a new Lists with the duplicate tests of each group removed.
+// The first seen spelling of each test is kept, along with the per-test
+// metadata of the removed spellings that the kept spelling does not have.
+func (l Lists) Dedup(canon Canonicalizer) Lists {
+	out := make(Lists, len(l))
+	for i, group := range l {
+		out[i] = canon.dedupGroup(group)
+	}
+	return out
+}
+
+// Merge returns a new Lists combining the groups of all the lists. Groups with
+// the same Name and API are merged into a single group holding the
+// deduplicated union of their tests, in the position of the first seen group.
+// As with Dedup, the per-test metadata of removed spellings is moved to the
+// kept spelling.
+func Merge(canon Canonicalizer, lists ...Lists) Lists {
+	type key struct {
+		name string
+		api  API
+	}
+	out := Lists{}
+	indices := map[key]int{}
+	for _, l := range lists {
+		for _, group := range l {
+			k := key{group.Name, group.API}
+			i, ok := indices[k]
+			if !ok {
+				indices[k] = len(out)
+				out = append(out, group.Filter(func(string) bool { return true }))
+				continue
+			}
+			merged := out[i]
+			merged.Tests = append(append([]string{}, merged.Tests...), group.Tests...)
+			if len(group.Disabled) > 0 {
+				merged.Disabled = Canonicalizer(nil).dedup(append(append([]string{}, merged.Disabled...), group.Disabled...))
+			}
+			for _, test := range group.Tests {
+				group.copyTestMeta(&merged, test, test)
+			}
+			out[i] = merged
+		}
+	}
+	for i := range out {
+		out[i] = canon.dedupGroup(out[i])
+	}
+	return out
+}
+
+// Intersect returns a new Lists containing only the tests of l that are also
+// found in other for the same API. Empty groups are dropped.
+func (l Lists) Intersect(other Lists, canon Canonicalizer) Lists {
+	sets := canon.canonicalByAPI(other)
+	out := Lists{}
+	for _, group := range l {
+		if filtered := canon.keep(group, sets[group.API], true); len(filtered.Tests) > 0 {
+			out = append(out, filtered)
+		}
+	}
+	return out
+}
+
+// Subtract returns a new Lists containing only the tests of l that are not
+// found in other for the same API. Empty groups are dropped.
+func (l Lists) Subtract(other Lists, canon Canonicalizer) Lists {
+	sets := canon.canonicalByAPI(other)
+	out := Lists{}
+	for _, group := range l {
+		if filtered := canon.keep(group, sets[group.API], false); len(filtered.Tests) > 0 {
+			out = append(out, filtered)
+		}
+	}
+	return out
+}
+
+// WriteFlat writes every test in l to w, one per line, sorted. If withAPI is
+// true, then each line is written in the form '<api>\t<test>'. Identical lines
+// are only written once.
+func (l Lists) WriteFlat(w io.Writer, withAPI bool) error {
+	lines := []string{}
+	for _, group := range l {
+		for _, test := range group.Tests {
+			if withAPI {
+				lines = append(lines, string(group.API)+"\t"+test)
+			} else {
+				lines = append(lines, test)
+			}
+		}
+	}
+	sort.Strings(lines)
+	for i, line := range lines {
+		if i > 0 && lines[i-1] == line {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return cause.Wrap(err, "Couldn't write test list")
+		}
+	}
+	return nil
+}
+
+// WalkGroups calls fn for each group in l, in order. If fn returns an error,
+// then WalkGroups stops and returns the error, wrapped with the name of the
+// group.
+func (l Lists) WalkGroups(fn func(g Group) error) error {
+	for _, group := range l {
+		if err := fn(group); err != nil {
+			return cause.Wrap(err, "Group '%s'", group.Name)
+		}
+	}
+	return nil
+}
+
+// Partition splits l into two new Lists: yes, holding the tests that match
+// the predicate, and no, holding the tests that do not. Both preserve the
+// groups of l, with empty groups dropped. Every test of l is found in exactly
+// one of the two lists.
+func (l Lists) Partition(pred func(api API, test string) bool) (yes, no Lists) {
+	yes, no = Lists{}, Lists{}
+	for _, group := range l {
+		matches := map[string]bool{}
+		for _, test := range group.Tests {
+			matches[test] = pred(group.API, test)
+		}
+		if g := group.Filter(func(test string) bool { return matches[test] }); len(g.Tests) > 0 {
+			yes = append(yes, g)
+		}
+		if g := group.Filter(func(test string) bool { return !matches[test] }); len(g.Tests) > 0 {
+			no = append(no, g)
+		}
+	}
+	return yes, no
+}
+
+// BlankGroups returns the names of the groups that hold no tests, in the order
+// of l.
+func (l Lists) BlankGroups() []string {
+	out := []string{}
+	for _, group := range l {
+		if len(group.Tests) == 0 {
+			out = append(out, group.Name)
+		}
+	}
+	return out
+}
+
+// FromMap returns a new Lists with a group for each API in m, holding the
+// sorted and deduplicated tests for that API. Each group is named after its
+// API and has no File. The groups are sorted by API.
+func FromMap(m map[API][]string) Lists {
+	out := make(Lists, 0, len(m))
+	for api, tests := range m {
+		out = append(out, Group{
+			Name:  string(api),
+			API:   api,
+			Tests: Canonicalizer(nil).dedup(tests),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].API < out[j].API })
+	return out
+}
+
+// MissingVariants looks for tests that begin with base and end with one of
+// the variant suffixes (for example '.vertex' and '.fragment'), and returns a
+// sorted description of each test, per group, that does not have all of the
+// variants. Each description is of the form
+// '<group>: <test> is missing <variant>, <variant>...', where <test> is the name
+// of the test with the variant suffix removed.
+func (l Lists) MissingVariants(base string, variants []string) []string {
+	out := []string{}
+	for _, group := range l {
+		found := map[string]map[string]bool{}
+		for _, test := range group.Tests {
+			if !strings.HasPrefix(test, base) {
+				continue
+			}
+			for _, variant := range variants {
+				if strings.HasSuffix(test, variant) {
+					name := strings.TrimSuffix(test, variant)
+					if found[name] == nil {
+						found[name] = map[string]bool{}
+					}
+					found[name][variant] = true
+				}
+			}
+		}
+		for name, present := range found {
+			missing := []string{}
+			for _, variant := range variants {
+				if !present[variant] {
+					missing = append(missing, variant)
+				}
+			}
+			if len(missing) > 0 {
+				out = append(out, fmt.Sprintf("%s: %s is missing %s",
+					group.Name, name, strings.Join(missing, ", ")))
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Trim returns a new Lists without the groups for which skip returns true.
+func (l Lists) Trim(skip func(g Group) bool) Lists {
+	out := Lists{}
+	for _, group := range l {
+		if !skip(group) {
+			out = append(out, group)
+		}
+	}
+	return out
+}
+
+// GroupHashes returns the CacheKey of each group, keyed by the group's Name.
+// If more than one group shares the same Name, then the hash for that Name is
+// derived from the CacheKeys of all of those groups, in order.
+func (l Lists) GroupHashes() map[string]string {
+	keys := map[string][]string{}
+	for _, group := range l {
+		keys[group.Name] = append(keys[group.Name], group.CacheKey())
+	}
+	out := make(map[string]string, len(keys))
+	for name, k := range keys {
+		if len(k) == 1 {
+			out[name] = k[0]
+			continue
+		}
+		h := sha1.New()
+		for _, key := range k {
+			h.Write([]byte(key))
+		}
+		out[name] = hex.EncodeToString(h.Sum(nil))
+	}
+	return out
+}
+
+// PlanEntry is a single test in an execution plan.
+type PlanEntry struct {
+	API   API
+	Group string // Name of the group holding the test
+	Test  string
+}
+
+// SchedulePlan returns an execution plan of all the tests in l. All the tests
+// of a single API are scheduled together, to minimize the number of switches
+// between APIs. APIs are ordered by their first appearance in l, and the
+// order of groups and tests within each API is preserved.
+func (l Lists) SchedulePlan() []PlanEntry {
+	apis := []API{}
+	byAPI := map[API][]Group{}
+	for _, group := range l {
+		if _, ok := byAPI[group.API]; !ok {
+			apis = append(apis, group.API)
+		}
+		byAPI[group.API] = append(byAPI[group.API], group)
+	}
+	out := []PlanEntry{}
+	for _, api := range apis {
+		for _, group := range byAPI[api] {
+			for _, test := range group.Tests {
+				out = append(out, PlanEntry{API: api, Group: group.Name, Test: test})
+			}
+		}
+	}
+	return out
+}
+
+// VerifyFilePaths checks that the File of each group, relative to root, is a
+// readable file. Groups without a File are skipped. Unlike Load, the files are
+// not parsed. The returned error lists every broken reference.
+func (l Lists) VerifyFilePaths(root string) error {
+	problems := []string{}
+	for _, group := range l {
+		if group.File == "" {
+			continue
+		}
+		path := filepath.Join(root, group.File)
+		info, err := os.Stat(path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Group '%s': %v", group.Name, err))
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			problems = append(problems, fmt.Sprintf("Group '%s': '%s' is not a regular file", group.Name, path))
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Group '%s': %v", group.Name, err))
+			continue
+		}
+		f.Close()
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d broken test file references:\n%s", len(problems), strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// testSet returns the set of all tests in l, regardless of API.
+func (l Lists) testSet() map[string]bool {
+	out := map[string]bool{}
+	for _, group := range l {
+		for _, test := range group.Tests {
+			out[test] = true
+		}
+	}
+	return out
+}
+
+// CoverageByPrefix returns, for each depth segment prefix of the known test
+// names (see PrefixCounts), the fraction of the known tests with that prefix
+// that are found in l. Tests are matched regardless of API.
+func (l Lists) CoverageByPrefix(known []string, depth int) map[string]float64 {
+	have := l.testSet()
+	total, covered := map[string]int{}, map[string]int{}
+	for _, test := range Canonicalizer(nil).dedup(known) {
+		prefix := namePrefix(test, depth)
+		total[prefix]++
+		if have[test] {
+			covered[prefix]++
+		}
+	}
+	out := make(map[string]float64, len(total))
+	for prefix, n := range total {
+		out[prefix] = float64(covered[prefix]) / float64(n)
+	}
+	return out
+}
+
+// FoldCase is a Canonicalizer that ignores differences in case.
+func FoldCase(test string) string {
+	return strings.ToLower(test)
+}
+
+// FoldCaseAndSeparators is a Canonicalizer that ignores differences in case,
+// and in the use of '.', '_' and '-' as separators.
+func FoldCaseAndSeparators(test string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '_', '-':
+			return '.'
+		}
+		return r
+	}, strings.ToLower(test))
+}
+
+// Reconcile is ReconcileWith using the FoldCase rename heuristic.
+func Reconcile(old, new Lists) (renames map[string]string, added, removed Lists) {
+	return ReconcileWith(old, new, FoldCase)
+}
+
+// ReconcileWith compares the tests of old and new, returning the tests that
+// were renamed, added and removed. A test only found in old is considered
+// renamed to a test only found in new, of the same API, if both have the same
+// key, and no other such test has that key. renames maps the old test name to
+// the new name. added holds the tests of new that were not found in old, and
+// were not renamed. removed holds the tests of old that are not found in new,
+// and were not renamed.
+func ReconcileWith(old, new Lists, key Canonicalizer) (renames map[string]string, added, removed Lists) {
+	oldTests, newTests := old.testsByAPI(), new.testsByAPI()
+	renames = map[string]string{}
+	renamedOld := map[API]map[string]bool{}
+	renamedNew := map[API]map[string]bool{}
+	for api, tests := range oldTests {
+		oldByKey, newByKey := map[string][]string{}, map[string][]string{}
+		for test := range tests {
+			if !newTests[api][test] {
+				k := key.canonical(test)
+				oldByKey[k] = append(oldByKey[k], test)
+			}
+		}
+		for test := range newTests[api] {
+			if !tests[test] {
+				k := key.canonical(test)
+				newByKey[k] = append(newByKey[k], test)
+			}
+		}
+		renamedOld[api], renamedNew[api] = map[string]bool{}, map[string]bool{}
+		for k, o := range oldByKey {
+			if n := newByKey[k]; len(o) == 1 && len(n) == 1 {
+				renames[o[0]] = n[0]
+				renamedOld[api][o[0]] = true
+				renamedNew[api][n[0]] = true
+			}
+		}
+	}
+
+	added, removed = Lists{}, Lists{}
+	for _, group := range new {
+		api := group.API
+		g := group.Filter(func(test string) bool {
+			return !oldTests[api][test] && !renamedNew[api][test]
+		})
+		if len(g.Tests) > 0 {
+			added = append(added, g)
+		}
+	}
+	for _, group := range old {
+		api := group.API
+		g := group.Filter(func(test string) bool {
+			return !newTests[api][test] && !renamedOld[api][test]
+		})
+		if len(g.Tests) > 0 {
+			removed = append(removed, g)
+		}
+	}
+	return renames, added, removed
+}
+
+// APIs returns the sorted list of unique APIs used by the groups of l.
+func (l Lists) APIs() []API {
+	seen := map[API]bool{}
+	out := []API{}
+	for _, group := range l {
+		if !seen[group.API] {
+			seen[group.API] = true
+			out = append(out, group.API)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// RebalancePerAPI returns a new Lists where, for each API, all the tests of
+// that API are redistributed into groupsPerAPI groups of near-equal size,
+// named '<api>.<i>' with i counting from 0. The groups hold contiguous runs of
+// the sorted tests. If an API has fewer tests than groupsPerAPI, then it gets
+// one group per test, so no empty groups are produced. The groups are sorted
+// by API. A groupsPerAPI of less than 1 is treated as 1.
+func (l Lists) RebalancePerAPI(groupsPerAPI int) Lists {
+	if groupsPerAPI < 1 {
+		groupsPerAPI = 1
+	}
+	out := Lists{}
+	for _, api := range l.APIs() {
+		all := l.Trim(func(g Group) bool { return g.API != api }).Flatten(string(api))
+		n := groupsPerAPI
+		if len(all.Tests) < n {
+			n = len(all.Tests)
+		}
+		start := 0
+		for i := 0; i < n; i++ {
+			end := start + len(all.Tests)/n
+			if i < len(all.Tests)%n {
+				end++
+			}
+			group := Group{Name: fmt.Sprintf("%s.%d", api, i), API: api}
+			for _, test := range all.Tests[start:end] {
+				group.Tests = append(group.Tests, test)
+				all.copyTestMeta(&group, test, test)
+			}
+			out = append(out, group)
+			start = end
+		}
+	}
+	return out
+}
+
+// NameLengthStats returns the minimum, maximum and average (rounded down)
+// length in bytes of the test names of each group, keyed by group Name. Groups
+// sharing the same Name are combined. Groups without tests are omitted.
+func (l Lists) NameLengthStats() map[string]struct{ Min, Max, Avg int } {
+	type stats struct{ min, max, total, count int }
+	byName := map[string]*stats{}
+	for _, group := range l {
+		for _, test := range group.Tests {
+			s, ok := byName[group.Name]
+			if !ok {
+				s = &stats{min: len(test), max: len(test)}
+				byName[group.Name] = s
+			}
+			if len(test) < s.min {
+				s.min = len(test)
+			}
+			if len(test) > s.max {
+				s.max = len(test)
+			}
+			s.total += len(test)
+			s.count++
+		}
+	}
+	out := make(map[string]struct{ Min, Max, Avg int }, len(byName))
+	for name, s := range byName {
+		out[name] = struct{ Min, Max, Avg int }{s.min, s.max, s.total / s.count}
+	}
+	return out
+}
+
+// DedupGroups returns a new Lists where groups with the same API and the same
+// set of tests are merged into a single group. Of each set of identical
+// groups, the group with the lexicographically first Name survives, in the
+// position of the first of the identical groups. The returned map holds, for
+// each surviving group that absorbed other groups, the sorted Names of the
+// groups it absorbed.
+func (l Lists) DedupGroups() (Lists, map[string][]string) {
+	type key struct {
+		api   API
+		tests string
+	}
+	keyOf := func(g Group) key {
+		return key{g.API, strings.Join(Canonicalizer(nil).dedup(g.Tests), "\n")}
+	}
+	survivors := map[key]int{} // key -> index in l of the surviving group
+	for i, group := range l {
+		k := keyOf(group)
+		if j, ok := survivors[k]; !ok || group.Name < l[j].Name {
+			survivors[k] = i
+		}
+	}
+	out := Lists{}
+	absorbed := map[string][]string{}
+	emitted := map[key]bool{}
+	for i, group := range l {
+		k := keyOf(group)
+		survivor := l[survivors[k]]
+		if survivors[k] != i && group.Name != survivor.Name {
+			absorbed[survivor.Name] = append(absorbed[survivor.Name], group.Name)
+		}
+		if !emitted[k] {
+			emitted[k] = true
+			out = append(out, survivor)
+		}
+	}
+	for _, names := range absorbed {
+		sort.Strings(names)
+	}
+	return out, absorbed
+}
+
+// AssignConsistent distributes the tests of l between the machines, using
+// rendezvous hashing of each test name and machine name. Unlike bin-packing,
+// adding or removing a machine only moves the tests assigned to (or taken by)
+// that machine, roughly 1/N of the tests. The returned map holds a Lists for
+// every machine, preserving the groups of l, with empty groups dropped.
+func (l Lists) AssignConsistent(machines []string) map[string]Lists {
+	out := make(map[string]Lists, len(machines))
+	for _, machine := range machines {
+		out[machine] = Lists{}
+	}
+	if len(machines) == 0 {
+		return out
+	}
+	for _, group := range l {
+		assigned := map[string]string{}
+		for _, test := range group.Tests {
+			best, bestScore := machines[0], uint64(0)
+			for i, machine := range machines {
+				h := fnv.New64a()
+				h.Write([]byte(machine))
+				h.Write([]byte{0})
+				h.Write([]byte(test))
+				if score := h.Sum64(); i == 0 || score > bestScore || (score == bestScore && machine < best) {
+					best, bestScore = machine, score
+				}
+			}
+			assigned[test] = best
+		}
+		for machine := range out {
+			filtered := group.Filter(func(test string) bool { return assigned[test] == machine })
+			if len(filtered.Tests) > 0 {
+				out[machine] = append(out[machine], filtered)
+			}
+		}
+	}
+	return out
+}
+
+// ContainsAll returns true if every test of required is found in l for the
+// same API. The returned Lists holds the tests of required that are missing
+// from l, sorted and grouped as they are in required, and is empty if all the
+// required tests are present.
+func (l Lists) ContainsAll(required Lists) (bool, Lists) {
+	missing := required.Subtract(l, nil).Dedup(nil)
+	return len(missing) == 0, missing
+}
+
+// WritePrometheus writes metrics describing the composition of l to w, in the
+// Prometheus text exposition format. Groups with the same API and Name are
+// reported as a single series.
+func (l Lists) WritePrometheus(w io.Writer) error {
+	type key struct {
+		api  API
+		name string
+	}
+	perGroup := map[key]int{}
+	perAPI := map[API]int{}
+	for _, group := range l {
+		perGroup[key{group.API, group.Name}] += len(group.Tests)
+		perAPI[group.API] += len(group.Tests)
+	}
+	groupKeys := make([]key, 0, len(perGroup))
+	for k := range perGroup {
+		groupKeys = append(groupKeys, k)
+	}
+	sort.Slice(groupKeys, func(i, j int) bool {
+		if groupKeys[i].api != groupKeys[j].api {
+			return groupKeys[i].api < groupKeys[j].api
+		}
+		return groupKeys[i].name < groupKeys[j].name
+	})
+
+	buf := bytes.Buffer{}
+	fmt.Fprintln(&buf, "# HELP testlist_groups_total The number of test groups.")
+	fmt.Fprintln(&buf, "# TYPE testlist_groups_total gauge")
+	fmt.Fprintf(&buf, "testlist_groups_total %d\n", len(l))
+	fmt.Fprintln(&buf, "# HELP testlist_tests_total The number of tests in each group.")
+	fmt.Fprintln(&buf, "# TYPE testlist_tests_total gauge")
+	for _, k := range groupKeys {
+		fmt.Fprintf(&buf, "testlist_tests_total{api=\"%s\",group=\"%s\"} %d\n",
+			escapePrometheusLabel(string(k.api)), escapePrometheusLabel(k.name), perGroup[k])
+	}
+	fmt.Fprintln(&buf, "# HELP testlist_tests The number of tests for each API.")
+	fmt.Fprintln(&buf, "# TYPE testlist_tests gauge")
+	for _, api := range l.APIs() {
+		fmt.Fprintf(&buf, "testlist_tests{api=\"%s\"} %d\n", escapePrometheusLabel(string(api)), perAPI[api])
+	}
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return cause.Wrap(err, "Couldn't write metrics")
+	}
+	return nil
+}
+
+// escapePrometheusLabel escapes a Prometheus label value.
+func escapePrometheusLabel(value string) string {
+	return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value)
+}
+
+// FilterPreview returns the tests that filtering l with the predicate would
+// keep, and those it would remove, for reporting the effect of a filter
+// before applying it. Both lists preserve the groups of l, with empty groups
+// dropped.
+func (l Lists) FilterPreview(predicate func(api API, test string) bool) (kept, removed Lists) {
+	return l.Partition(predicate)
+}
+
+// NoExpectation is the ByExpectation key for tests without an expectation.
+const NoExpectation = "none"
+
+// ByExpectation partitions the tests of l by their expected status, keyed by
+// the status string, which may be a status that is not one of Statuses, such
+// as 'SKIP'. Tests without an expectation are found under the NoExpectation
+// key. Each Lists preserves the groups of l, with empty groups dropped.
+func (l Lists) ByExpectation() map[string]Lists {
+	out := map[string]Lists{}
+	for _, group := range l {
+		byStatus := map[string]bool{}
+		for _, test := range group.Tests {
+			byStatus[group.expectation(test)] = true
+		}
+		for status := range byStatus {
+			out[status] = append(out[status], group.Filter(func(test string) bool {
+				return group.expectation(test) == status
+			}))
+		}
+	}
+	return out
+}
+
+// SuggestAdditions returns up to k of the candidate tests that would most
+// improve the per-prefix coverage of l, where prefixes are the first depth
+// segments of the test names (see PrefixCounts). The coverage of a prefix is
+// the fraction of the tests of l and candidates with that prefix that are in
+// l. Each suggestion is taken from the prefix with the lowest coverage at that
+// point, so suggestions are spread across the under-covered prefixes. Within a
+// prefix, candidates are suggested in the order they are given. Candidates
+// already in l are never suggested.
+func (l Lists) SuggestAdditions(candidates []string, k int, depth int) []string {
+	have := l.testSet()
+	total, covered := map[string]int{}, map[string]int{}
+	for test := range have {
+		prefix := namePrefix(test, depth)
+		total[prefix]++
+		covered[prefix]++
+	}
+	queues := map[string][]string{} // prefix -> candidates, in rank order
+	seen := map[string]bool{}
+	for _, test := range candidates {
+		if have[test] || seen[test] {
+			continue
+		}
+		seen[test] = true
+		prefix := namePrefix(test, depth)
+		total[prefix]++
+		queues[prefix] = append(queues[prefix], test)
+	}
+
+	out := []string{}
+	for len(out) < k {
+		best, bestCoverage, found := "", 0.0, false
+		for prefix, queue := range queues {
+			if len(queue) == 0 {
+				continue
+			}
+			coverage := float64(covered[prefix]) / float64(total[prefix])
+			if !found || coverage < bestCoverage || (coverage == bestCoverage && prefix < best) {
+				best, bestCoverage, found = prefix, coverage, true
+			}
+		}
+		if !found {
+			break
+		}
+		out = append(out, queues[best][0])
+		queues[best] = queues[best][1:]
+		covered[best]++
+	}
+	return out
+}
+
+// Timeouts returns the Timeout of each group, keyed by the group's Name.
+// Groups without a timeout have a zero duration.
+func (l Lists) Timeouts() map[string]time.Duration {
+	out := make(map[string]time.Duration, len(l))
+	for _, group := range l {
+		out[group.Name] = group.Timeout
+	}
+	return out
+}
+
+// expectations returns the expected status of every test in l, keyed by test
+// name, as returned by Group.expectation. If a test is found in more than one
+// group, the first group's expectation is used.
+func (l Lists) expectations() map[string]string {
+	out := map[string]string{}
+	for _, group := range l {
+		for _, test := range group.Tests {
+			if _, ok := out[test]; !ok {
+				out[test] = group.expectation(test)
+			}
+		}
+	}
+	return out
+}
+
+// ExpectationDiff returns the tests whose expected status differs between old
+// and new, keyed by test name, with the old and new status. A test without an
+// expectation has the status NoExpectation, and a test that is missing from
+// one of the lists has an empty status. Tests with an unchanged status are
+// omitted.
+func ExpectationDiff(old, new Lists) map[string][2]string {
+	oldStatus, newStatus := old.expectations(), new.expectations()
+	out := map[string][2]string{}
+	for test, o := range oldStatus {
+		if n := newStatus[test]; n != o {
+			out[test] = [2]string{o, n}
+		}
+	}
+	for test, n := range newStatus {
+		if _, ok := oldStatus[test]; !ok {
+			out[test] = [2]string{"", n}
+		}
+	}
+	return out
+}
+
+// Canonicalize returns a normalized copy of l, for use in comparisons and
+// cache keys. Leading and trailing whitespace is trimmed from test names, and
+// tests with empty names are removed. The tests of each group are sorted and
+// deduplicated, with the per-test metadata of duplicated tests taken from the
+// first occurrence. Disabled tests are sorted and deduplicated. The Meta of
+// each group is kept, with an empty Meta replaced by nil. The File of each
+// group is cleared, as it depends on where the lists were loaded from.
+// Finally, the groups are sorted by API then Name.
+func (l Lists) Canonicalize() Lists {
+	out := make(Lists, len(l))
+	for i, group := range l {
+		c := Group{
+			Name:    group.Name,
+			API:     group.API,
+			Timeout: group.Timeout,
+		}
+		for _, test := range group.Tests {
+			if trimmed := strings.TrimSpace(test); trimmed != "" {
+				c.Tests = append(c.Tests, trimmed)
+				group.copyTestMeta(&c, test, trimmed)
+			}
+		}
+		c.Tests = Canonicalizer(nil).dedup(c.Tests)
+		if len(group.Disabled) > 0 {
+			c.Disabled = Canonicalizer(nil).dedup(group.Disabled)
+		}
+		if len(group.Meta) > 0 {
+			c.Meta = make(map[string]string, len(group.Meta))
+			for key, value := range group.Meta {
+				c.Meta[key] = value
+			}
+		}
+		out[i] = c
+	}
+	sort.Stable(out)
+	return out
+}
+
+// ContentHash returns the Hash of the Canonicalize form of l. Unlike Hash, the
+// content hash does not depend on the order of the groups, or on where the
+// lists were loaded from.
+func (l Lists) ContentHash() string {
+	return l.Canonicalize().Hash()
+}
+
+// groupContents returns a string describing the API and the sorted,
+// deduplicated tests of all the groups of l, keyed by group Name.
+func (l Lists) groupContents() map[string]string {
+	byName := map[string]Lists{}
+	for _, group := range l {
+		byName[group.Name] = append(byName[group.Name], group)
+	}
+	out := make(map[string]string, len(byName))
+	for name, groups := range byName {
+		parts := []string{}
+		for api, tests := range groups.testsByAPI() {
+			for test := range tests {
+				parts = append(parts, string(api)+"\t"+test)
+			}
+		}
+		sort.Strings(parts)
+		out[name] = strings.Join(parts, "\n")
+	}
+	return out
+}
+
+// ReconcileGroups compares the groups of a and b by Name, returning the sorted
+// Names of the groups only found in a, only found in b, found in both with
+// different tests, and found in both with the same tests. Groups with the same
+// Name but a different API are considered conflicting.
+func ReconcileGroups(a, b Lists) (onlyA, onlyB, conflicting, identical []string) {
+	contentsA, contentsB := a.groupContents(), b.groupContents()
+	for name, contentA := range contentsA {
+		contentB, ok := contentsB[name]
+		switch {
+		case !ok:
+			onlyA = append(onlyA, name)
+		case contentA == contentB:
+			identical = append(identical, name)
+		default:
+			conflicting = append(conflicting, name)
+		}
+	}
+	for name := range contentsB {
+		if _, ok := contentsA[name]; !ok {
+			onlyB = append(onlyB, name)
+		}
+	}
+	sort.Strings(onlyA)
+	sort.Strings(onlyB)
+	sort.Strings(conflicting)
+	sort.Strings(identical)
+	return onlyA, onlyB, conflicting, identical
+}
+
+// PatchTo returns, for each group, the tests that need to be added to and
+// removed from l to turn it into target, keyed by group Name. Groups are
+// matched by Name and API. Groups only found in target list all their tests
+// in Add, and groups only found in l list all their tests in Remove. Groups
+// that need no changes are omitted. Add and Remove are sorted.
+func (l Lists) PatchTo(target Lists) map[string]struct{ Add, Remove []string } {
+	type key struct {
+		name string
+		api  API
+	}
+	collect := func(lists Lists) map[key]map[string]bool {
+		out := map[key]map[string]bool{}
+		for _, group := range lists {
+			k := key{group.Name, group.API}
+			if out[k] == nil {
+				out[k] = map[string]bool{}
+			}
+			for _, test := range group.Tests {
+				out[k][test] = true
+			}
+		}
+		return out
+	}
+	from, to := collect(l), collect(target)
+	keys := map[key]bool{}
+	for k := range from {
+		keys[k] = true
+	}
+	for k := range to {
+		keys[k] = true
+	}
+
+	out := map[string]struct{ Add, Remove []string }{}
+	for k := range keys {
+		patch := out[k.name]
+		for test := range to[k] {
+			if !from[k][test] {
+				patch.Add = append(patch.Add, test)
+			}
+		}
+		for test := range from[k] {
+			if !to[k][test] {
+				patch.Remove = append(patch.Remove, test)
+			}
+		}
+		if len(patch.Add) > 0 || len(patch.Remove) > 0 {
+			sort.Strings(patch.Add)
+			sort.Strings(patch.Remove)
+			out[k.name] = patch
+		}
+	}
+	return out
 }
 
-// Load loads the test list file and appends all tests to the Group.
-func (g *Group) Load() error {
-	tests, err := ioutil.ReadFile(g.File)
-	if err != nil {
-		return cause.Wrap(err, "Couldn't read '%s'", tests)
+// FindSharedFiles returns the sorted Names of the groups that share the same
+// File, keyed by File, for each File used by more than one group. Groups
+// without a File are ignored.
+func (l Lists) FindSharedFiles() map[string][]string {
+	byFile := map[string][]string{}
+	for _, group := range l {
+		if group.File != "" {
+			byFile[group.File] = append(byFile[group.File], group.Name)
+		}
 	}
-	for _, line := range strings.Split(string(tests), "\n") {
-		line = strings.TrimSpace(line)
-		if line != "" && !strings.HasPrefix(line, "#") {
-			g.Tests = append(g.Tests, line)
+	out := map[string][]string{}
+	for file, names := range byFile {
+		if len(names) > 1 {
+			sort.Strings(names)
+			out[file] = names
 		}
 	}
-	sort.Strings(g.Tests)
-	return nil
+	return out
 }
 
-// Filter returns a new Group that contains only tests that match the predicate.
-func (g Group) Filter(pred func(string) bool) Group {
-	out := Group{
-		Name: g.Name,
-		File: g.File,
-		API:  g.API,
+// PartitionByFamily returns the groups of l keyed by the Family of their API,
+// preserving the order of the groups.
+func (l Lists) PartitionByFamily() map[string]Lists {
+	out := map[string]Lists{}
+	for _, group := range l {
+		family := group.API.Family()
+		out[family] = append(out[family], group)
 	}
-	for _, test := range g.Tests {
-		if pred(test) {
-			out.Tests = append(out.Tests, test)
+	return out
+}
+
+// DistinguishingTests returns the tests found in both a and b, for the same
+// API, whose expected status differs between a and b. The returned Lists has
+// a group per API, as built by FromMap, and is empty if a and b agree on the
+// expectations of all their common tests.
+func DistinguishingTests(a, b Lists) Lists {
+	byAPI := func(l Lists) map[API]map[string]string {
+		out := map[API]map[string]string{}
+		for _, group := range l {
+			if out[group.API] == nil {
+				out[group.API] = map[string]string{}
+			}
+			for _, test := range group.Tests {
+				if _, ok := out[group.API][test]; !ok {
+					out[group.API][test] = group.expectation(test)
+				}
+			}
 		}
+		return out
 	}
-	return out
+	statusA, statusB := byAPI(a), byAPI(b)
+	differ := map[API][]string{}
+	for api, tests := range statusA {
+		for test, sa := range tests {
+			if sb, ok := statusB[api][test]; ok && sa != sb {
+				differ[api] = append(differ[api], test)
+			}
+		}
+	}
+	return FromMap(differ)
 }
 
-// Limit returns a new Group that contains a maximum of limit tests.
-func (g Group) Limit(limit int) Group {
-	out := Group{
-		Name:  g.Name,
-		File:  g.File,
-		API:   g.API,
-		Tests: g.Tests,
+// GroupsWithMeta returns a new Lists holding the groups of l whose Meta has
+// the given value for key.
+func (l Lists) GroupsWithMeta(key, value string) Lists {
+	return l.Trim(func(g Group) bool {
+		v, ok := g.Meta[key]
+		return !ok || v != value
+	})
+}
+
+// WriteCanonicalText writes l to w as line-oriented text suited to diffing.
+// Groups are sorted by API then Name, with groups of the same API and Name
+// combined. Each group is written as a '# <api> <name>' header line followed
+// by its sorted tests, one per line, with a blank line between groups. The
+// output does not depend on the order of the groups in l.
+func (l Lists) WriteCanonicalText(w io.Writer) error {
+	buf := bytes.Buffer{}
+	for i, group := range Merge(nil, l.Canonicalize()) {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "# %s %s\n", group.API, group.Name)
+		for _, test := range group.Tests {
+			fmt.Fprintln(&buf, test)
+		}
 	}
-	if len(g.Tests) > limit {
-		out.Tests = g.Tests[:limit]
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return cause.Wrap(err, "Couldn't write test list")
+	}
+	return nil
+}
+
+// HashChain returns a SHA1 hash for each group, where each hash is derived
+// from the previous group's hash and the group's CacheKey. As each hash
+// depends on all the groups before it, reordering the groups will change the
+// chain even if the content of each group is unchanged.
+func (l Lists) HashChain() []string {
+	out := make([]string, len(l))
+	prev := ""
+	for i, group := range l {
+		h := sha1.New()
+		h.Write([]byte(prev))
+		h.Write([]byte(group.CacheKey()))
+		prev = hex.EncodeToString(h.Sum(nil))
+		out[i] = prev
 	}
 	return out
 }
 
-// Lists is the full list of tests to be run.
-type Lists []Group
+// jsonGroup is the JSON representation of a single group in the test list
+// json file. A group either references a test file with "tests", or lists
+// its tests with "inline".
+type jsonGroup struct {
+	Name     string
+	API      string
+	TestFile string            `json:"tests"`
+	Inline   []string          `json:"inline"`
+	Timeout  string            `json:"timeout"`
+	Meta     map[string]string `json:"meta"`
+}
 
-// Filter returns a new Lists that contains only tests that match the predicate.
-func (l Lists) Filter(pred func(string) bool) Lists {
-	out := Lists{}
-	for _, group := range l {
-		filtered := group.Filter(pred)
-		if len(filtered.Tests) > 0 {
-			out = append(out, filtered)
+// newGroup returns a new Group, without any tests, for the json group.
+func (j jsonGroup) newGroup() (Group, error) {
+	group := Group{
+		Name: j.Name,
+		API:  API(j.API),
+		Meta: j.Meta,
+	}
+	if j.Timeout != "" {
+		timeout, err := time.ParseDuration(j.Timeout)
+		if err != nil {
+			return Group{}, cause.Wrap(err, "Invalid timeout '%s' for group '%s'", j.Timeout, j.Name)
 		}
+		group.Timeout = timeout
 	}
-	return out
+	return group, nil
 }
 
-// Hash returns a SHA1 hash of the set of tests.
-func (l Lists) Hash() string {
-	h := sha1.New()
-	if err := gob.NewEncoder(h).Encode(l); err != nil {
-		panic(cause.Wrap(err, "Could not encode testlist to produce hash"))
+// isInline returns true if the group lists its tests inline.
+func (j jsonGroup) isInline() bool {
+	return j.Inline != nil
+}
+
+// inlineTests returns the inline tests in the test list file format.
+func (j jsonGroup) inlineTests() []byte {
+	return []byte(strings.Join(j.Inline, "\n"))
+}
+
+// LoadOptions holds optional settings for LoadWithOptions.
+type LoadOptions struct {
+	// ResolveSymlinks, if true, resolves symbolic links to test files before
+	// they are read. Group.File will hold the resolved path.
+	ResolveSymlinks bool
+	// RenameTests maps old test names to new test names. Loaded tests found
+	// in the map are renamed, and any duplicates resulting from the renaming
+	// are removed.
+	RenameTests map[string]string
+	// Warn, if not nil, is called with a message for each non-fatal problem
+	// found while loading.
+	Warn func(msg string)
+	// Columnar, if true, parses each test file line as a test name optionally
+	// followed by a tab and a comma separated list of flags, which are stored
+	// in Group.Flags.
+	Columnar bool
+	// OrderHints, if true, parses 'after:<test>' ordering hints following
+	// test names, which are stored in Group.After.
+	OrderHints bool
+	// Lenient, if true, ignores trailing commas in the test list json file,
+	// reporting a warning for each one.
+	Lenient bool
+	// ParseDisabled, if true, parses '# DISABLED <test>' comment lines,
+	// storing the disabled tests in Group.Disabled.
+	ParseDisabled bool
+	// Blocklist, if not empty, is the path to a test list file of tests that
+	// are removed from every loaded group, regardless of API.
+	Blocklist string
+	// DropBlockedGroups, if true, drops groups that hold no tests once the
+	// Blocklist tests have been removed.
+	DropBlockedGroups bool
+	// MergeDuplicateGroups, if true, merges groups with the same Name and API
+	// into a single group, in the position of the first of those groups.
+	MergeDuplicateGroups bool
+	// ConflictPolicy controls how tests found in more than one of the merged
+	// groups, but with different metadata, are resolved. It also resolves Meta
+	// keys given different values by the merged groups.
+	ConflictPolicy ConflictPolicy
+}
+
+// ConflictPolicy is an enumerator of ways to resolve tests with conflicting
+// metadata.
+type ConflictPolicy int
+
+const (
+	// FirstWins keeps the metadata of the first seen test.
+	FirstWins ConflictPolicy = iota
+	// LastWins keeps the metadata of the last seen test.
+	LastWins
+	// ConflictError returns an error naming the test or Meta key and both
+	// sources.
+	ConflictError
+)
+
+// warn calls o.Warn with the formatted message, if o.Warn is not nil.
+func (o LoadOptions) warn(msg string, args ...interface{}) {
+	if o.Warn != nil {
+		o.Warn(fmt.Sprintf(msg, args...))
 	}
-	return hex.EncodeToString(h.Sum(nil))
 }
 
-// Load loads the test list json file and returns the full set of tests.
-func Load(root, jsonPath string) (Lists, error) {
+// Stdin is the json path that loads the test list from os.Stdin instead of a
+// file. Test lists loaded from stdin must use inline tests.
+const Stdin = "-"
+
+// index is a parsed test list json file.
+type index struct {
+	root   string // absolute path of the root directory
+	dir    string // absolute path of the directory holding the json file
+	groups []jsonGroup
+	opts   LoadOptions
+}
+
+// parseIndex parses the content of the test list json file. jsonPath is only
+// used for messages.
+func parseIndex(data []byte, jsonPath string, opts LoadOptions) ([]jsonGroup, error) {
+	commas := findTrailingCommas(data)
+	if opts.Lenient && len(commas) > 0 {
+		stripped := make([]byte, 0, len(data))
+		last := 0
+		for _, offset := range commas {
+			line, col := lineColumn(data, offset)
+			opts.warn("'%s':%d:%d: Ignoring trailing comma", jsonPath, line, col)
+			stripped = append(stripped, data[last:offset]...)
+			last = offset + 1
+		}
+		data = append(stripped, data[last:]...)
+	}
+
+	var jsonGroups []jsonGroup
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&jsonGroups); err != nil {
+		if len(commas) > 0 && !opts.Lenient {
+			line, col := lineColumn(data, commas[0])
+			return nil, cause.Wrap(err, "Couldn't parse '%s': trailing comma at line %d, column %d", jsonPath, line, col)
+		}
+		return nil, cause.Wrap(err, "Couldn't parse '%s'", jsonPath)
+	}
+	for _, jsonGroup := range jsonGroups {
+		switch {
+		case jsonGroup.TestFile != "" && jsonGroup.isInline():
+			return nil, fmt.Errorf("Group '%s' in '%s' specifies both 'tests' and 'inline'", jsonGroup.Name, jsonPath)
+		case jsonGroup.TestFile == "" && !jsonGroup.isInline():
+			return nil, fmt.Errorf("Group '%s' in '%s' specifies neither 'tests' nor 'inline'", jsonGroup.Name, jsonPath)
+		}
+	}
+	return jsonGroups, nil
+}
+
+// findTrailingCommas returns the byte offsets of all the commas in the json
+// data that are followed only by whitespace before a closing ']' or '}'.
+func findTrailingCommas(data []byte) []int {
+	var out []int
+	comma := -1
+	inString, escaped := false, false
+	for i, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case ',':
+			comma = i
+			continue
+		case ']', '}':
+			if comma >= 0 {
+				out = append(out, comma)
+			}
+		case '"':
+			inString = true
+		}
+		comma = -1
+	}
+	return out
+}
+
+// lineColumn returns the 1-based line and column of the byte offset in data.
+func lineColumn(data []byte, offset int) (line, column int) {
+	line = 1 + bytes.Count(data[:offset], []byte("\n"))
+	column = 1 + offset - (bytes.LastIndexByte(data[:offset], '\n') + 1)
+	return line, column
+}
+
+// loadIndex reads and parses the test list json file, without loading any of
+// the referenced test files.
+func loadIndex(root, jsonPath string, opts LoadOptions) (index, error) {
 	root, err := filepath.Abs(root)
 	if err != nil {
-		return nil, cause.Wrap(err, "Couldn't get absolute path of '%s'", root)
+		return index{}, cause.Wrap(err, "Couldn't get absolute path of '%s'", root)
+	}
+
+	if jsonPath == Stdin {
+		return loadStdinIndex(root, opts)
 	}
 
 	jsonPath, err = filepath.Abs(jsonPath)
 	if err != nil {
-		return nil, cause.Wrap(err, "Couldn't get absolute path of '%s'", jsonPath)
+		return index{}, cause.Wrap(err, "Couldn't get absolute path of '%s'", jsonPath)
 	}
 
 	i, err := ioutil.ReadFile(jsonPath)
 	if err != nil {
-		return nil, cause.Wrap(err, "Couldn't read test list from '%s'", jsonPath)
+		return index{}, cause.Wrap(err, "Couldn't read test list from '%s'", jsonPath)
 	}
 
-	var jsonGroups []struct {
-		Name     string
-		API      string
-		TestFile string `json:"tests"`
+	jsonGroups, err := parseIndex(i, jsonPath, opts)
+	if err != nil {
+		return index{}, err
 	}
-	if err := json.NewDecoder(bytes.NewReader(i)).Decode(&jsonGroups); err != nil {
-		return nil, cause.Wrap(err, "Couldn't parse '%s'", jsonPath)
+
+	return index{root: root, dir: filepath.Dir(jsonPath), groups: jsonGroups, opts: opts}, nil
+}
+
+// loadStdinIndex reads and parses the test list json file from os.Stdin.
+// As there is no directory to resolve test files against, all groups must
+// use inline tests.
+func loadStdinIndex(root string, opts LoadOptions) (index, error) {
+	i, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return index{}, cause.Wrap(err, "Couldn't read test list from stdin")
+	}
+
+	jsonGroups, err := parseIndex(i, "<stdin>", opts)
+	if err != nil {
+		return index{}, err
+	}
+	for _, jsonGroup := range jsonGroups {
+		if !jsonGroup.isInline() {
+			return index{}, fmt.Errorf("Group '%s' references test file '%s', but "+
+				"test lists read from stdin can only use inline tests", jsonGroup.Name, jsonGroup.TestFile)
+		}
+	}
+
+	return index{root: root, groups: jsonGroups, opts: opts}, nil
+}
+
+// loadGroup loads the tests of the i'th group of the index.
+func (idx index) loadGroup(i int) (Group, error) {
+	jsonGroup := idx.groups[i]
+	group, err := jsonGroup.newGroup()
+	if err != nil {
+		return Group{}, err
+	}
+
+	if jsonGroup.isInline() {
+		if err := group.parse(jsonGroup.inlineTests(), idx.opts); err != nil {
+			return Group{}, err
+		}
+		idx.postLoad(&group)
+		return group, nil
+	}
+
+	group.File = filepath.Join(idx.dir, jsonGroup.TestFile)
+	if idx.opts.ResolveSymlinks {
+		resolved, err := resolveSymlinks(group.File)
+		if err != nil {
+			return Group{}, err
+		}
+		group.File = resolved
+	}
+	if err := group.load(idx.opts); err != nil {
+		return Group{}, err
+	}
+	idx.postLoad(&group)
+
+	// Make the path relative before displaying it to the world.
+	relPath, err := filepath.Rel(idx.root, group.File)
+	if err != nil {
+		return Group{}, cause.Wrap(err, "Couldn't get relative path for '%s'", group.File)
+	}
+	group.File = relPath
+
+	return group, nil
+}
+
+// source returns a description of where the tests of the i'th group of the
+// index, loaded as group, come from, for use in messages.
+func (idx index) source(i int, group Group) string {
+	if group.File != "" {
+		return fmt.Sprintf("'%s'", group.File)
+	}
+	return fmt.Sprintf("the inline tests of group %d of the index", i+1)
+}
+
+// postLoad applies the load options to the newly loaded group.
+func (idx index) postLoad(group *Group) {
+	if len(idx.opts.RenameTests) > 0 {
+		group.rename(idx.opts.RenameTests)
+	}
+	if len(group.Tests) == 0 {
+		idx.opts.warn("Group '%s' contains no tests", group.Name)
+	}
+}
+
+// resolveSymlinks follows the chain of symbolic links starting at path,
+// returning the absolute path of the final target. An error is returned if
+// the chain of links forms a loop.
+func resolveSymlinks(path string) (string, error) {
+	seen := map[string]bool{}
+	for {
+		if seen[path] {
+			return "", fmt.Errorf("Symlink loop detected at '%s'", path)
+		}
+		seen[path] = true
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			return "", cause.Wrap(err, "Couldn't stat '%s'", path)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			break
+		}
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", cause.Wrap(err, "Couldn't read symlink '%s'", path)
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = target
+	}
+
+	// Resolve any symlinks in the parent directories.
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", cause.Wrap(err, "Couldn't resolve symlinks of '%s'", path)
+	}
+	return filepath.Abs(resolved)
+}
+
+// Load loads the test list json file and returns the full set of tests.
+// The groups are returned in the order they are listed in the json file. Use
+// sort.Sort to put the groups into canonical order.
+// If jsonPath is Stdin, then the test list is read from os.Stdin.
+func Load(root, jsonPath string) (Lists, error) {
+	return LoadWithOptions(root, jsonPath, LoadOptions{})
+}
+
+// LoadWithOptions loads the test list json file using the given options and
+// returns the full set of tests.
+func LoadWithOptions(root, jsonPath string, opts LoadOptions) (Lists, error) {
+	idx, err := loadIndex(root, jsonPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	blocked, err := opts.loadBlocklist()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(Lists, 0, len(idx.groups))
+	sources := make([]string, 0, len(idx.groups))
+	for i := range idx.groups {
+		group, err := idx.loadGroup(i)
+		if err != nil {
+			return nil, err
+		}
+		if blocked != nil {
+			group = group.Filter(func(test string) bool { return !blocked[test] })
+			if len(group.Tests) == 0 && opts.DropBlockedGroups {
+				continue
+			}
+		}
+		out = append(out, group)
+		sources = append(sources, idx.source(i, group))
+	}
+
+	if opts.MergeDuplicateGroups {
+		return mergeDuplicateGroups(out, sources, opts.ConflictPolicy)
 	}
+	return out, nil
+}
+
+// mergeMeta merges the Meta of group into merged, resolving keys with
+// different values using the policy. sources maps each Meta key of merged to
+// the source that provided its value, and is updated as keys are merged.
+// source is the description of where group was loaded from.
+func mergeMeta(merged *Group, group Group, sources map[string]string, source string, policy ConflictPolicy) error {
+	if len(group.Meta) == 0 {
+		return nil
+	}
+	meta := make(map[string]string, len(merged.Meta)+len(group.Meta))
+	for key, value := range merged.Meta {
+		meta[key] = value
+	}
+	for key, value := range group.Meta {
+		existing, exists := meta[key]
+		switch {
+		case !exists || policy == LastWins:
+			meta[key] = value
+			sources[key] = source
+		case existing == value || policy == FirstWins:
+		case policy == ConflictError:
+			return fmt.Errorf("Meta '%s' of group '%s' has conflicting values in %s and %s",
+				key, group.Name, sources[key], source)
+		}
+	}
+	merged.Meta = meta
+	return nil
+}
 
-	dir := filepath.Dir(jsonPath)
+// loadBlocklist returns the set of tests in the Blocklist file, or nil if there
+// is no Blocklist.
+func (o LoadOptions) loadBlocklist() (map[string]bool, error) {
+	if o.Blocklist == "" {
+		return nil, nil
+	}
+	blocklist := Group{Name: "blocklist", File: o.Blocklist}
+	if err := blocklist.Load(); err != nil {
+		return nil, err
+	}
+	blocked := map[string]bool{}
+	for _, test := range blocklist.Tests {
+		blocked[test] = true
+	}
+	return blocked, nil
+}
 
-	out := make(Lists, len(jsonGroups))
-	for i, jsonGroup := range jsonGroups {
-		group := Group{
-			Name: jsonGroup.Name,
-			File: filepath.Join(dir, jsonGroup.TestFile),
-			API:  API(jsonGroup.API),
+// mergeDuplicateGroups returns a new Lists where groups with the same Name and
+// API are merged into a single group, with tests that have conflicting
+// metadata resolved using the policy. sources holds the description of where
+// the tests of each group of l come from, and is only used for messages.
+func mergeDuplicateGroups(l Lists, sources []string, policy ConflictPolicy) (Lists, error) {
+	type key struct {
+		name string
+		api  API
+	}
+	out := Lists{}
+	indices := map[key]int{}
+	providers := map[key]map[string]string{} // test -> source that provided the test
+	metaSources := []map[string]string{}     // out index -> Meta key -> source that provided the value
+	for g, group := range l {
+		k := key{group.Name, group.API}
+		i, ok := indices[k]
+		if !ok {
+			indices[k] = len(out)
+			providers[k] = map[string]string{}
+			for _, test := range group.Tests {
+				providers[k][test] = sources[g]
+			}
+			metaSources = append(metaSources, map[string]string{})
+			for name := range group.Meta {
+				metaSources[len(metaSources)-1][name] = sources[g]
+			}
+			out = append(out, group.Filter(func(string) bool { return true }))
+			continue
+		}
+		merged := &out[i]
+		for _, test := range group.Tests {
+			source, exists := providers[k][test]
+			if !exists {
+				providers[k][test] = sources[g]
+				merged.Tests = append(merged.Tests, test)
+				group.copyTestMeta(merged, test, test)
+				continue
+			}
+			if merged.testMeta(test) == group.testMeta(test) {
+				continue
+			}
+			switch policy {
+			case LastWins:
+				providers[k][test] = sources[g]
+				merged.clearTestMeta(test)
+				group.copyTestMeta(merged, test, test)
+			case ConflictError:
+				return nil, fmt.Errorf("Test '%s' of group '%s' has conflicting metadata in %s and %s",
+					test, group.Name, source, sources[g])
+			}
 		}
-		if err := group.Load(); err != nil {
+		if len(group.Disabled) > 0 {
+			merged.Disabled = Canonicalizer(nil).dedup(append(append([]string{}, merged.Disabled...), group.Disabled...))
+		}
+		if err := mergeMeta(merged, group, metaSources[i], sources[g], policy); err != nil {
 			return nil, err
 		}
+		sort.Strings(merged.Tests)
+	}
+	return out, nil
+}
+
+// LoadBudgeted is like Load, but stops loading further groups once budget has
+// elapsed, returning the groups loaded so far. The returned bool is true if
+// all the groups were loaded. An error is only returned if the test list could
+// not be loaded, or if ctx is cancelled.
+func LoadBudgeted(ctx context.Context, root, jsonPath string, budget time.Duration) (Lists, bool, error) {
+	deadline := time.Now().Add(budget)
+
+	idx, err := loadIndex(root, jsonPath, LoadOptions{})
+	if err != nil {
+		return nil, false, err
+	}
+
+	out := make(Lists, 0, len(idx.groups))
+	for i := range idx.groups {
+		if err := ctx.Err(); err != nil {
+			return out, false, cause.Wrap(err, "Loading of '%s' cancelled", jsonPath)
+		}
+		if time.Now().After(deadline) {
+			return out, false, nil
+		}
+		group, err := idx.loadGroup(i)
+		if err != nil {
+			return nil, false, err
+		}
+		out = append(out, group)
+	}
+
+	return out, true, nil
+}
+
+// FindOrphanFiles returns the sorted paths, relative to root, of the '.txt'
+// files in the directory of the test list json file that are not referenced by
+// the test list. Subdirectories are not searched.
+func FindOrphanFiles(root, jsonPath string) ([]string, error) {
+	return findOrphanFiles(root, jsonPath, false)
+}
+
+// FindOrphanFilesRecursive is like FindOrphanFiles, but also searches all the
+// subdirectories of the test list json file's directory.
+func FindOrphanFilesRecursive(root, jsonPath string) ([]string, error) {
+	return findOrphanFiles(root, jsonPath, true)
+}
+
+func findOrphanFiles(root, jsonPath string, recursive bool) ([]string, error) {
+	idx, err := loadIndex(root, jsonPath, LoadOptions{})
+	if err != nil {
+		return nil, err
+	}
+	referenced := map[string]bool{}
+	for _, jsonGroup := range idx.groups {
+		if !jsonGroup.isInline() {
+			referenced[filepath.Join(idx.dir, jsonGroup.TestFile)] = true
+		}
+	}
 
-		// Make the path relative before displaying it to the world.
-		relPath, err := filepath.Rel(root, group.File)
+	out := []string{}
+	err = filepath.Walk(idx.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != idx.dir && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".txt" || referenced[path] {
+			return nil
+		}
+		relPath, err := filepath.Rel(idx.root, path)
 		if err != nil {
-			return nil, cause.Wrap(err, "Couldn't get relative path for '%s'", group.File)
+			return cause.Wrap(err, "Couldn't get relative path for '%s'", path)
 		}
-		group.File = relPath
+		out = append(out, relPath)
+		return nil
+	})
+	if err != nil {
+		return nil, cause.Wrap(err, "Couldn't search '%s' for test files", idx.dir)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Reload returns a copy of l where the groups whose File is changedFile have
+// had their tests reloaded from disk. root is the root directory used to load
+// l, and changedFile may either be absolute or relative to root. An error is
+// returned if no group uses changedFile. Reload should only be used for lists
+// loaded with Load; use ReloadWithOptions for lists loaded with
+// LoadWithOptions.
+func (l Lists) Reload(root, changedFile string) (Lists, error) {
+	return l.ReloadWithOptions(root, changedFile, LoadOptions{})
+}
 
-		out[i] = group
+// ReloadWithOptions is like Reload, except that the changed file is loaded
+// with the same options that LoadWithOptions uses to load each group, which
+// should be the options used to load l. Groups left empty by the Blocklist are
+// dropped if DropBlockedGroups is set. As the groups merged by
+// MergeDuplicateGroups cannot be reloaded from a single file, an error is
+// returned if MergeDuplicateGroups is set.
+func (l Lists) ReloadWithOptions(root, changedFile string, opts LoadOptions) (Lists, error) {
+	if opts.MergeDuplicateGroups {
+		return nil, fmt.Errorf("Cannot reload test lists loaded with MergeDuplicateGroups")
+	}
+	blocked, err := opts.loadBlocklist()
+	if err != nil {
+		return nil, err
+	}
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, cause.Wrap(err, "Couldn't get absolute path of '%s'", root)
+	}
+	if !filepath.IsAbs(changedFile) {
+		changedFile = filepath.Join(root, changedFile)
+	}
+	relPath, err := filepath.Rel(root, changedFile)
+	if err != nil {
+		return nil, cause.Wrap(err, "Couldn't get relative path for '%s'", changedFile)
 	}
 
+	idx := index{root: root, opts: opts}
+	out := make(Lists, 0, len(l))
+	found := false
+	for _, group := range l {
+		if group.File == "" || filepath.Clean(group.File) != relPath {
+			out = append(out, group)
+			continue
+		}
+		found = true
+		reloaded := Group{
+			Name:    group.Name,
+			File:    changedFile,
+			API:     group.API,
+			Timeout: group.Timeout,
+			Meta:    group.Meta,
+		}
+		if err := reloaded.load(opts); err != nil {
+			return nil, err
+		}
+		idx.postLoad(&reloaded)
+		reloaded.File = group.File
+		if blocked != nil {
+			reloaded = reloaded.Filter(func(test string) bool { return !blocked[test] })
+			if len(reloaded.Tests) == 0 && opts.DropBlockedGroups {
+				continue
+			}
+		}
+		out = append(out, reloaded)
+	}
+	if !found {
+		return nil, fmt.Errorf("No group uses the test file '%s'", relPath)
+	}
 	return out, nil
 }
 
+// Verify checks that the test list json file and all the test files it
+// references can be loaded, and that every group uses a known API, returning
+// an error listing every problem found, including every problem within each
+// test file. Unknown expectation statuses are also reported as problems. Test
+// files are read a line at a time and their tests are not kept, so memory use
+// depends on the size of the json file and the longest line, not on the size
+// of the test files.
+func Verify(root, jsonPath string) error {
+	idx, err := loadIndex(root, jsonPath, LoadOptions{})
+	if err != nil {
+		return err
+	}
+	problems := []string{}
+	for _, jsonGroup := range idx.groups {
+		group, err := jsonGroup.newGroup()
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		api, groupProblems := idx.verifyGroup(jsonGroup, group)
+		problems = append(problems, groupProblems...)
+		switch api {
+		case EGL, GLES2, GLES3, Vulkan:
+		default:
+			problems = append(problems, fmt.Sprintf("Group '%s' has unknown API '%s'", group.Name, api))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems found in '%s':\n%s", len(problems), jsonPath, strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// verifyGroup parses the tests of the json group, without keeping them,
+// returning the group's API and every problem found.
+func (idx index) verifyGroup(jsonGroup jsonGroup, group Group) (API, []string) {
+	if !jsonGroup.isInline() {
+		group.File = filepath.Join(idx.dir, jsonGroup.TestFile)
+	}
+	p := newLineParser(group, idx.opts)
+	problems := []string{}
+	check := func(line string) {
+		t, err := p.parse(line)
+		if err != nil {
+			problems = append(problems, err.Error())
+			return
+		}
+		if msg := p.warning(t); msg != "" {
+			problems = append(problems, msg)
+		}
+	}
+
+	if jsonGroup.isInline() {
+		for _, test := range jsonGroup.Inline {
+			for _, line := range strings.Split(test, "\n") {
+				check(line)
+			}
+		}
+		return p.api, problems
+	}
+
+	f, err := os.Open(group.File)
+	if err != nil {
+		return p.api, append(problems, cause.Wrap(err, "Couldn't read '%s'", group.File).Error())
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		check(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		problems = append(problems, cause.Wrap(err, "Couldn't read '%s'", group.File).Error())
+	}
+	return p.api, problems
+}
+
 // Status is an enumerator of test results.
 type Status string
 
@@ -216,6 +3039,16 @@ var Statuses = []Status{
 	QualityWarning,
 }
 
+// valid returns true if s is one of Statuses.
+func (s Status) valid() bool {
+	for _, status := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
 // Failing returns true if the task status requires fixing.
 func (s Status) Failing() bool {
 	switch s {
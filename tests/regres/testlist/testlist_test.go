@@ -0,0 +1,677 @@
+// Copyright 2019 The SwiftShader Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testlist
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tempDir creates a temporary directory holding the given files, keyed by
+// path relative to the directory, and returns its path.
+func tempDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "testlist")
+	if err != nil {
+		t.Fatalf("Couldn't create temporary directory: %v", err)
+	}
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatalf("Couldn't create directory for '%s': %v", path, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatalf("Couldn't write '%s': %v", path, err)
+		}
+	}
+	return dir
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		file string
+		opts LoadOptions
+	}{
+		{
+			name: "hash in name",
+			file: "# comment\ndEQP-VK.a#b\ndEQP-VK.c [platform:linux] [expect:FAIL]\n",
+		},
+		{
+			name: "columnar",
+			file: "dEQP-VK.a\tf1,f2\ndEQP-VK.b after:dEQP-VK.a\n# DISABLED dEQP-VK.c\n",
+			opts: LoadOptions{Columnar: true, OrderHints: true, ParseDisabled: true},
+		},
+	} {
+		dir := tempDir(t, map[string]string{"tests.txt": test.file})
+		defer os.RemoveAll(dir)
+
+		loaded := Group{Name: test.name, File: filepath.Join(dir, "tests.txt")}
+		if err := loaded.load(test.opts); err != nil {
+			t.Fatalf("%s: load failed: %v", test.name, err)
+		}
+		buf := bytes.Buffer{}
+		if err := loaded.WriteWithOptions(&buf, test.opts); err != nil {
+			t.Fatalf("%s: WriteWithOptions failed: %v", test.name, err)
+		}
+		reloaded := Group{Name: test.name, File: loaded.File}
+		if err := reloaded.parse(buf.Bytes(), test.opts); err != nil {
+			t.Fatalf("%s: reload failed: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(loaded, reloaded) {
+			t.Errorf("%s: round trip changed the group.\nWritten:\n%s\nGot:  %+v\nWant: %+v",
+				test.name, buf.String(), reloaded, loaded)
+		}
+	}
+}
+
+func TestWriteRejectsMisparsedNames(t *testing.T) {
+	for _, test := range []struct {
+		group Group
+		opts  LoadOptions
+	}{
+		{Group{Tests: []string{"#a"}}, LoadOptions{}},
+		{Group{Tests: []string{" a"}}, LoadOptions{}},
+		{Group{Tests: []string{"a\nb"}}, LoadOptions{}},
+		{Group{Tests: []string{"a [platform:linux]"}}, LoadOptions{}},
+		{Group{Tests: []string{"a\tb"}}, LoadOptions{Columnar: true}},
+		{Group{Tests: []string{"a after:b"}}, LoadOptions{OrderHints: true}},
+		{Group{Tests: []string{"a"}, Flags: map[string][]string{"a": {"f"}}}, LoadOptions{}},
+		{Group{Tests: []string{"a"}, After: map[string][]string{"a": {"b"}}}, LoadOptions{}},
+	} {
+		if err := test.group.WriteWithOptions(ioutil.Discard, test.opts); err == nil {
+			t.Errorf("WriteWithOptions(%q, %+v) did not return an error", test.group.Tests, test.opts)
+		}
+	}
+	for _, test := range []string{"a\tb", "a after:b", "a#b", "a [b]"} {
+		if err := (Group{Tests: []string{test}}).Write(ioutil.Discard); err != nil {
+			t.Errorf("Write(%q) returned error: %v", test, err)
+		}
+	}
+}
+
+func TestPrefixCounts(t *testing.T) {
+	lists := Lists{
+		{API: Vulkan, Tests: []string{"dEQP-VK.api.a", "dEQP-VK.api.b", "dEQP-VK.draw.a"}},
+		{API: GLES3, Tests: []string{"dEQP-GLES3.a", "other"}},
+	}
+	for _, test := range []struct {
+		depth int
+		want  map[string]int
+	}{
+		{-1, map[string]int{"dEQP-VK": 3, "dEQP-GLES3": 1, "other": 1}},
+		{0, map[string]int{"dEQP-VK": 3, "dEQP-GLES3": 1, "other": 1}},
+		{1, map[string]int{"dEQP-VK": 3, "dEQP-GLES3": 1, "other": 1}},
+		{2, map[string]int{"dEQP-VK.api": 2, "dEQP-VK.draw": 1, "dEQP-GLES3.a": 1, "other": 1}},
+		{5, map[string]int{"dEQP-VK.api.a": 1, "dEQP-VK.api.b": 1, "dEQP-VK.draw.a": 1, "dEQP-GLES3.a": 1, "other": 1}},
+	} {
+		if got := lists.PrefixCounts(test.depth); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("PrefixCounts(%d) = %v, want %v", test.depth, got, test.want)
+		}
+	}
+}
+
+func TestLoadStripsBOM(t *testing.T) {
+	group := Group{Name: "bom", File: filepath.Join("testdata", "bom.txt")}
+	if err := group.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if want := []string{"dEQP-VK.a", "dEQP-VK.b"}; !reflect.DeepEqual(group.Tests, want) {
+		t.Errorf("Load of '%s' returned tests %q, want %q", group.File, group.Tests, want)
+	}
+}
+
+func TestLoadTrailingComma(t *testing.T) {
+	index := `[
+  {
+    "name": "vk",
+    "api": "vulkan",
+    "tests": "vk.txt",
+  },
+]`
+	dir := tempDir(t, map[string]string{"tests.json": index, "vk.txt": "dEQP-VK.a\n"})
+	defer os.RemoveAll(dir)
+	jsonPath := filepath.Join(dir, "tests.json")
+
+	_, err := Load(dir, jsonPath)
+	if err == nil {
+		t.Fatalf("Load of index with trailing commas did not return an error")
+	}
+	if want := "trailing comma at line 5, column 22"; !strings.Contains(err.Error(), want) {
+		t.Errorf("Load returned error '%v', want it to contain '%s'", err, want)
+	}
+
+	warnings := []string{}
+	opts := LoadOptions{Lenient: true, Warn: func(msg string) { warnings = append(warnings, msg) }}
+	lists, err := LoadWithOptions(dir, jsonPath, opts)
+	if err != nil {
+		t.Fatalf("Lenient LoadWithOptions failed: %v", err)
+	}
+	if len(lists) != 1 || !reflect.DeepEqual(lists[0].Tests, []string{"dEQP-VK.a"}) {
+		t.Errorf("Lenient LoadWithOptions returned %+v", lists)
+	}
+	want := []string{
+		"'" + jsonPath + "':5:22: Ignoring trailing comma",
+		"'" + jsonPath + "':6:4: Ignoring trailing comma",
+	}
+	if !reflect.DeepEqual(warnings, want) {
+		t.Errorf("Lenient LoadWithOptions warned %q, want %q", warnings, want)
+	}
+}
+
+func TestSchedulePlanMinimizesAPISwitches(t *testing.T) {
+	lists := Lists{
+		{Name: "vk-a", API: Vulkan, Tests: []string{"dEQP-VK.a1", "dEQP-VK.a2"}},
+		{Name: "gles-a", API: GLES3, Tests: []string{"dEQP-GLES3.a1"}},
+		{Name: "vk-b", API: Vulkan, Tests: []string{"dEQP-VK.b1"}},
+		{Name: "gles-b", API: GLES3, Tests: []string{"dEQP-GLES3.b1", "dEQP-GLES3.b2"}},
+		{Name: "vk-c", API: Vulkan, Tests: []string{"dEQP-VK.c1"}},
+	}
+	plan := lists.SchedulePlan()
+
+	switches := 0
+	for i := 1; i < len(plan); i++ {
+		if plan[i].API != plan[i-1].API {
+			switches++
+		}
+	}
+	if switches != 1 {
+		t.Errorf("SchedulePlan switched APIs %d times, want 1. Plan: %+v", switches, plan)
+	}
+
+	want := []PlanEntry{
+		{Vulkan, "vk-a", "dEQP-VK.a1"},
+		{Vulkan, "vk-a", "dEQP-VK.a2"},
+		{Vulkan, "vk-b", "dEQP-VK.b1"},
+		{Vulkan, "vk-c", "dEQP-VK.c1"},
+		{GLES3, "gles-a", "dEQP-GLES3.a1"},
+		{GLES3, "gles-b", "dEQP-GLES3.b1"},
+		{GLES3, "gles-b", "dEQP-GLES3.b2"},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("SchedulePlan returned %+v, want %+v", plan, want)
+	}
+}
+
+// largeLists returns a Lists holding the given number of tests, spread across
+// Vulkan and GLES groups, with some per-test metadata.
+func largeLists(tests int) Lists {
+	vk := Group{Name: "vk", File: "vk.txt", API: Vulkan, Platforms: map[string][]string{}}
+	gles := Group{Name: "gles", File: "gles.txt", API: GLES3, Expectations: map[string]Status{}}
+	for i := 0; i < tests/2; i++ {
+		test := fmt.Sprintf("dEQP-VK.group%d.subgroup%d.test%d", i/1000, i/100, i)
+		vk.Tests = append(vk.Tests, test)
+		if i%10 == 0 {
+			vk.Platforms[test] = []string{"linux"}
+		}
+		test = fmt.Sprintf("dEQP-GLES3.group%d.subgroup%d.test%d", i/1000, i/100, i)
+		gles.Tests = append(gles.Tests, test)
+		if i%10 == 0 {
+			gles.Expectations[test] = Fail
+		}
+	}
+	return Lists{vk, gles}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	for _, lists := range []Lists{
+		nil,
+		{},
+		largeLists(100),
+		{
+			{Name: "empty", Tests: []string{}, Platforms: map[string][]string{}},
+			{
+				Name:         "full",
+				File:         "full.txt",
+				API:          Vulkan,
+				Tests:        []string{"dEQP-VK.a", "dEQP-VK.a.b", "dEQP-VK.c"},
+				Platforms:    map[string][]string{"dEQP-VK.a": {"linux"}, "dEQP-VK.c": nil},
+				Flags:        map[string][]string{"dEQP-VK.a.b": {}},
+				After:        map[string][]string{"dEQP-VK.c": {"dEQP-VK.a"}},
+				Expectations: map[string]Status{"dEQP-VK.c": Fail},
+				Disabled:     []string{"dEQP-VK.d"},
+				Timeout:      time.Minute,
+				Meta:         map[string]string{"owner": "graphics"},
+			},
+		},
+	} {
+		data, err := lists.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %v", err)
+		}
+		got, err := UnmarshalBinary(data)
+		if err != nil {
+			t.Fatalf("UnmarshalBinary failed: %v", err)
+		}
+		if !reflect.DeepEqual(got, lists) {
+			t.Errorf("UnmarshalBinary returned %#v, want %#v", got, lists)
+		}
+		for n := len(binaryMagic) + 1; n < len(data); n++ {
+			if _, err := UnmarshalBinary(data[:n]); err == nil {
+				t.Errorf("UnmarshalBinary of data truncated to %d bytes did not return an error", n)
+				break
+			}
+		}
+	}
+
+	if _, err := UnmarshalBinary([]byte("not a test list")); err == nil {
+		t.Errorf("UnmarshalBinary of invalid data did not return an error")
+	}
+}
+
+func TestBinaryDecodesGobVersion(t *testing.T) {
+	lists := largeLists(10)
+	buf := bytes.Buffer{}
+	buf.WriteString(binaryMagic)
+	buf.WriteByte(binaryVersionGob)
+	if err := gob.NewEncoder(&buf).Encode([]Group(lists)); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	got, err := UnmarshalBinary(buf.Bytes())
+	if err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, lists) {
+		t.Errorf("UnmarshalBinary returned %+v, want %+v", got, lists)
+	}
+}
+
+func TestBinaryGobField(t *testing.T) {
+	type holder struct{ L Lists }
+	in := holder{largeLists(10)}
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	out := holder{}
+	if err := gob.NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("Decode returned %+v, want %+v", out, in)
+	}
+}
+
+func BenchmarkMarshalBinary(b *testing.B) {
+	lists := largeLists(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, err := lists.MarshalBinary()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportMetric(float64(len(data)), "encoded-bytes")
+	}
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+	lists := largeLists(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data, err := json.Marshal(lists)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.ReportMetric(float64(len(data)), "encoded-bytes")
+	}
+}
+
+func BenchmarkUnmarshalBinary(b *testing.B) {
+	data, err := largeLists(100000).MarshalBinary()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(data)), "encoded-bytes")
+}
+
+func BenchmarkUnmarshalJSON(b *testing.B) {
+	data, err := json.Marshal(largeLists(100000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var lists Lists
+		if err := json.Unmarshal(data, &lists); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(data)), "encoded-bytes")
+}
+
+func TestLoadInlineAndFileGroups(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		index   string
+		want    Lists
+		wantErr string
+	}{
+		{
+			name:  "inline only",
+			index: `[{"name": "vk", "api": "vulkan", "inline": ["dEQP-VK.b", "dEQP-VK.a"]}]`,
+			want:  Lists{{Name: "vk", API: Vulkan, Tests: []string{"dEQP-VK.a", "dEQP-VK.b"}}},
+		},
+		{
+			name:  "file only",
+			index: `[{"name": "vk", "api": "vulkan", "tests": "vk.txt"}]`,
+			want:  Lists{{Name: "vk", File: "vk.txt", API: Vulkan, Tests: []string{"dEQP-VK.c"}}},
+		},
+		{
+			name:    "both",
+			index:   `[{"name": "vk", "api": "vulkan", "tests": "vk.txt", "inline": ["dEQP-VK.a"]}]`,
+			wantErr: "Group 'vk' in '%s' specifies both 'tests' and 'inline'",
+		},
+	} {
+		dir := tempDir(t, map[string]string{"tests.json": test.index, "vk.txt": "dEQP-VK.c\n"})
+		defer os.RemoveAll(dir)
+		jsonPath := filepath.Join(dir, "tests.json")
+
+		got, err := Load(dir, jsonPath)
+		if test.wantErr != "" {
+			if want := fmt.Sprintf(test.wantErr, jsonPath); err == nil || err.Error() != want {
+				t.Errorf("%s: Load returned error '%v', want '%s'", test.name, err, want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Load failed: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Load returned %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAssignConsistentMovesFewTests(t *testing.T) {
+	lists := largeLists(10000)
+	machines := []string{}
+	for i := 0; i < 9; i++ {
+		machines = append(machines, fmt.Sprintf("machine-%d", i))
+	}
+
+	// owners returns the machine assigned each test, keyed by API and test.
+	owners := func(machines []string) map[string]string {
+		out := map[string]string{}
+		for machine, lists := range lists.AssignConsistent(machines) {
+			for _, group := range lists {
+				for _, test := range group.Tests {
+					out[string(group.API)+" "+test] = machine
+				}
+			}
+		}
+		return out
+	}
+
+	before := owners(machines)
+	after := owners(append(machines, "machine-new"))
+	if len(before) != 10000 || len(after) != 10000 {
+		t.Fatalf("AssignConsistent assigned %d and %d tests, want 10000", len(before), len(after))
+	}
+	moved := 0
+	for test, machine := range after {
+		if machine != before[test] {
+			moved++
+			if machine != "machine-new" {
+				t.Errorf("Test '%s' moved from '%s' to '%s', not the new machine", test, before[test], machine)
+			}
+		}
+	}
+	// Adding a 10th machine should move about 1/10 of the tests.
+	if fraction := float64(moved) / 10000; fraction < 0.07 || fraction > 0.13 {
+		t.Errorf("Adding a machine moved %.3f of the tests, want about 0.1", fraction)
+	}
+}
+
+func TestConflictErrorNamesSources(t *testing.T) {
+	index := `[
+  {"name": "vk", "api": "vulkan", "tests": "vk.txt"},
+  {"name": "vk", "api": "vulkan", "inline": ["dEQP-VK.a [expect:FAIL]"]}
+]`
+	dir := tempDir(t, map[string]string{"tests.json": index, "vk.txt": "dEQP-VK.a\n"})
+	defer os.RemoveAll(dir)
+
+	opts := LoadOptions{MergeDuplicateGroups: true, ConflictPolicy: ConflictError}
+	_, err := LoadWithOptions(dir, filepath.Join(dir, "tests.json"), opts)
+	want := "Test 'dEQP-VK.a' of group 'vk' has conflicting metadata in 'vk.txt' and " +
+		"the inline tests of group 2 of the index"
+	if err == nil || err.Error() != want {
+		t.Errorf("LoadWithOptions returned error '%v', want '%s'", err, want)
+	}
+}
+
+func TestReloadWithOptions(t *testing.T) {
+	dir := tempDir(t, map[string]string{
+		"tests.json": `[{"name": "vk", "api": "vulkan", "tests": "vk.txt"}]`,
+		"vk.txt":     "dEQP-VK.a\n",
+		"block.txt":  "dEQP-VK.blocked\n",
+	})
+	defer os.RemoveAll(dir)
+	opts := LoadOptions{
+		Columnar:    true,
+		RenameTests: map[string]string{"dEQP-VK.old": "dEQP-VK.new"},
+		Blocklist:   filepath.Join(dir, "block.txt"),
+	}
+	lists, err := LoadWithOptions(dir, filepath.Join(dir, "tests.json"), opts)
+	if err != nil {
+		t.Fatalf("LoadWithOptions failed: %v", err)
+	}
+
+	changed := "dEQP-VK.old\tf1\ndEQP-VK.blocked\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "vk.txt"), []byte(changed), 0666); err != nil {
+		t.Fatalf("Couldn't write test file: %v", err)
+	}
+	got, err := lists.ReloadWithOptions(dir, "vk.txt", opts)
+	if err != nil {
+		t.Fatalf("ReloadWithOptions failed: %v", err)
+	}
+	want := Lists{{
+		Name:  "vk",
+		File:  "vk.txt",
+		API:   Vulkan,
+		Tests: []string{"dEQP-VK.new"},
+		Flags: map[string][]string{"dEQP-VK.new": {"f1"}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReloadWithOptions returned %+v, want %+v", got, want)
+	}
+
+	if _, err := lists.ReloadWithOptions(dir, "other.txt", opts); err == nil {
+		t.Errorf("ReloadWithOptions of an unused file did not return an error")
+	}
+}
+
+func TestMetaIsKept(t *testing.T) {
+	a := Lists{{Name: "vk", API: Vulkan, Tests: []string{"a"}, Meta: map[string]string{"owner": "x"}}}
+	b := Lists{{Name: "vk", API: Vulkan, Tests: []string{"a"}, Meta: map[string]string{"owner": "y"}}}
+	if a.ContentHash() == b.ContentHash() {
+		t.Errorf("ContentHash does not depend on Meta")
+	}
+	if got := a.Canonicalize()[0].Meta; !reflect.DeepEqual(got, a[0].Meta) {
+		t.Errorf("Canonicalize returned Meta %v, want %v", got, a[0].Meta)
+	}
+
+	index := `[
+  {"name": "vk", "api": "vulkan", "tests": "vk.txt", "meta": {"owner": "x", "component": "c"}},
+  {"name": "vk", "api": "vulkan", "tests": "vk2.txt", "meta": {"owner": "y", "team": "t"}}
+]`
+	dir := tempDir(t, map[string]string{"tests.json": index, "vk.txt": "dEQP-VK.a\n", "vk2.txt": "dEQP-VK.b\n"})
+	defer os.RemoveAll(dir)
+	jsonPath := filepath.Join(dir, "tests.json")
+
+	for _, test := range []struct {
+		policy ConflictPolicy
+		want   map[string]string
+	}{
+		{FirstWins, map[string]string{"owner": "x", "component": "c", "team": "t"}},
+		{LastWins, map[string]string{"owner": "y", "component": "c", "team": "t"}},
+	} {
+		opts := LoadOptions{MergeDuplicateGroups: true, ConflictPolicy: test.policy}
+		lists, err := LoadWithOptions(dir, jsonPath, opts)
+		if err != nil {
+			t.Fatalf("LoadWithOptions failed: %v", err)
+		}
+		if len(lists) != 1 || !reflect.DeepEqual(lists[0].Meta, test.want) {
+			t.Errorf("Merging LoadWithOptions with policy %v returned %+v, want Meta %v", test.policy, lists, test.want)
+		}
+	}
+	opts := LoadOptions{MergeDuplicateGroups: true, ConflictPolicy: ConflictError}
+	want := "Meta 'owner' of group 'vk' has conflicting values in 'vk.txt' and 'vk2.txt'"
+	if _, err := LoadWithOptions(dir, jsonPath, opts); err == nil || err.Error() != want {
+		t.Errorf("Merging LoadWithOptions returned error '%v', want '%s'", err, want)
+	}
+
+	lists, err := Load(dir, jsonPath)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	reloaded, err := lists.Reload(dir, "vk.txt")
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if !reflect.DeepEqual(reloaded[0].Meta, lists[0].Meta) {
+		t.Errorf("Reload returned Meta %v, want %v", reloaded[0].Meta, lists[0].Meta)
+	}
+}
+
+func TestEmptyPlatformAnnotation(t *testing.T) {
+	group := Group{Name: "vk", File: "vk.txt"}
+	file := "dEQP-VK.a [platform:]\ndEQP-VK.b [platform: , ]\ndEQP-VK.c [platform:linux]\n"
+	if err := group.parse([]byte(file), LoadOptions{}); err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if want := []string{"dEQP-VK.a", "dEQP-VK.b", "dEQP-VK.c"}; !reflect.DeepEqual(group.Tests, want) {
+		t.Errorf("parse returned tests %q, want %q", group.Tests, want)
+	}
+	for _, test := range []string{"dEQP-VK.a", "dEQP-VK.b"} {
+		if !group.RunsOn(test, "android") {
+			t.Errorf("Test '%s' with an empty platform annotation does not run on android", test)
+		}
+	}
+	if group.RunsOn("dEQP-VK.c", "android") {
+		t.Errorf("Test 'dEQP-VK.c' restricted to linux runs on android")
+	}
+}
+
+func TestDedupMovesMetadata(t *testing.T) {
+	group := Group{Name: "vk", File: "vk.txt", API: Vulkan}
+	if err := group.parse([]byte("dEQP-VK.Foo\ndEQP-VK.foo [platform:linux]\n"), LoadOptions{}); err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	got := Lists{group}.Dedup(FoldCase)
+	want := Lists{{
+		Name:      "vk",
+		File:      "vk.txt",
+		API:       Vulkan,
+		Tests:     []string{"dEQP-VK.Foo"},
+		Platforms: map[string][]string{"dEQP-VK.Foo": {"linux"}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Dedup returned %+v, want %+v", got, want)
+	}
+	if filtered := got.FilterPlatform("android"); len(filtered) != 0 {
+		t.Errorf("FilterPlatform(android) returned %+v, want no groups", filtered)
+	}
+
+	a := Lists{{Name: "g", API: Vulkan, Tests: []string{"a"}}}
+	b := Lists{{Name: "g", API: Vulkan, Tests: []string{"A"}, Expectations: map[string]Status{"A": Fail}}}
+	merged := Merge(FoldCase, a, b)
+	want = Lists{{Name: "g", API: Vulkan, Tests: []string{"a"}, Expectations: map[string]Status{"a": Fail}}}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("Merge returned %+v, want %+v", merged, want)
+	}
+}
+
+func TestUnknownExpectation(t *testing.T) {
+	dir := tempDir(t, map[string]string{
+		"tests.json": `[{"name": "vk", "api": "vulkan", "tests": "vk.txt"}]`,
+		"vk.txt":     "dEQP-VK.a [expect:SKIP]\ndEQP-VK.b [expect:FAIL]\ndEQP-VK.c\n",
+	})
+	defer os.RemoveAll(dir)
+
+	warnings := []string{}
+	opts := LoadOptions{Warn: func(msg string) { warnings = append(warnings, msg) }}
+	lists, err := LoadWithOptions(dir, filepath.Join(dir, "tests.json"), opts)
+	if err != nil {
+		t.Fatalf("LoadWithOptions failed: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "unknown expectation 'SKIP'") {
+		t.Errorf("LoadWithOptions warned %q, want a warning for 'SKIP'", warnings)
+	}
+
+	got := map[string][]string{}
+	for status, l := range lists.ByExpectation() {
+		for _, group := range l {
+			got[status] = append(got[status], group.Tests...)
+		}
+	}
+	want := map[string][]string{"SKIP": {"dEQP-VK.a"}, "FAIL": {"dEQP-VK.b"}, NoExpectation: {"dEQP-VK.c"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ByExpectation returned %v, want %v", got, want)
+	}
+}
+
+func TestVerifyReportsEveryProblem(t *testing.T) {
+	dir := tempDir(t, map[string]string{
+		"tests.json": `[
+			{"name": "vk", "api": "vulkan", "tests": "vk.txt"},
+			{"name": "gles", "tests": "gles.txt"},
+			{"name": "missing", "api": "vulkan", "tests": "missing.txt"},
+			{"name": "inline", "api": "vulkan", "inline": ["dEQP-VK.x [expect:BAD]"]}
+		]`,
+		"vk.txt":   "\ufeff# api: gles2\ndEQP-VK.a [expect:SKIP]\ndEQP-VK.b [expect:FLAKY]\n",
+		"gles.txt": "\ufeff# api: gles2\ndEQP-GLES2.a\n",
+	})
+	defer os.RemoveAll(dir)
+
+	if err := Verify(dir, filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("Verify of a missing json file succeeded")
+	}
+
+	err := Verify(dir, filepath.Join(dir, "tests.json"))
+	if err == nil {
+		t.Fatalf("Verify succeeded, want problems")
+	}
+	for _, want := range []string{
+		"5 problems found",
+		"declares API 'gles2', but group 'vk' has API 'vulkan'",
+		"unknown expectation 'SKIP' for test 'dEQP-VK.a'",
+		"unknown expectation 'FLAKY' for test 'dEQP-VK.b'",
+		"Couldn't read",
+		"unknown expectation 'BAD' for test 'dEQP-VK.x'",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Verify returned %q, want it to contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "group 'gles'") || strings.Contains(err.Error(), "Group 'gles'") {
+		t.Errorf("Verify reported the 'gles' group, whose API comes from its '# api:' directive: %v", err)
+	}
+}
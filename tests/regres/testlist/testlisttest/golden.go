@@ -0,0 +1,53 @@
+// Copyright 2019 The SwiftShader Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testlisttest provides utilities for testing code that uses the
+// testlist package.
+package testlisttest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"../../testlist"
+)
+
+// AssertGolden compares got, encoded with Lists.MarshalInlineJSON, against the
+// content of the file at goldenPath, reporting a test error if they differ.
+// If update is true, then the golden file is instead overwritten with got.
+func AssertGolden(t testing.TB, got testlist.Lists, goldenPath string, update bool) {
+	t.Helper()
+
+	data, err := got.MarshalInlineJSON()
+	if err != nil {
+		t.Fatalf("Couldn't encode test list: %v", err)
+	}
+	data = append(data, '\n')
+
+	if update {
+		if err := ioutil.WriteFile(goldenPath, data, 0666); err != nil {
+			t.Fatalf("Couldn't write golden file '%s': %v", goldenPath, err)
+		}
+		return
+	}
+
+	golden, err := ioutil.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("Couldn't read golden file '%s': %v", goldenPath, err)
+	}
+	if !bytes.Equal(data, golden) {
+		t.Errorf("Test list does not match golden file '%s'.\nGot:\n%s\nWant:\n%s", goldenPath, data, golden)
+	}
+}
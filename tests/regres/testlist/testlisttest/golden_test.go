@@ -0,0 +1,51 @@
+// Copyright 2019 The SwiftShader Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testlisttest
+
+import (
+	"flag"
+	"testing"
+
+	"../../testlist"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestFilterPlatformGolden(t *testing.T) {
+	lists := testlist.Lists{
+		{
+			Name:  "vk",
+			API:   testlist.Vulkan,
+			Tests: []string{"dEQP-VK.a", "dEQP-VK.b", "dEQP-VK.c", "dEQP-VK.d"},
+			Platforms: map[string][]string{
+				"dEQP-VK.b": {"linux"},
+				"dEQP-VK.c": {"android"},
+			},
+			Expectations: map[string]testlist.Status{"dEQP-VK.a": testlist.Fail},
+			Flags:        map[string][]string{"dEQP-VK.b": {"slow"}},
+			After:        map[string][]string{"dEQP-VK.d": {"dEQP-VK.a"}},
+			Disabled:     []string{"dEQP-VK.e"},
+		},
+		{
+			Name:  "gles",
+			API:   testlist.GLES3,
+			Tests: []string{"dEQP-GLES3.a"},
+			Platforms: map[string][]string{
+				"dEQP-GLES3.a": {"android"},
+			},
+		},
+	}
+	AssertGolden(t, lists.FilterPlatform("linux"), "testdata/filter_platform.json", *update)
+}
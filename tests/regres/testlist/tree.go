@@ -0,0 +1,99 @@
+// Copyright 2019 The SwiftShader Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testlist
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TreeNode is a node in the tree of '.' separated test name segments.
+type TreeNode struct {
+	// Name is the name segment of this node.
+	Name string
+	// Leaves is the number of tests at or below this node.
+	Leaves int
+	// Children are the child nodes, sorted by Name.
+	Children []*TreeNode
+}
+
+// Tree returns the tree of the test name segments of all the tests in l,
+// regardless of API. The root node has an empty Name.
+func (l Lists) Tree() *TreeNode {
+	root := &TreeNode{}
+	for test := range l.testSet() {
+		root.add(strings.Split(test, "."))
+	}
+	root.sort()
+	return root
+}
+
+// APITree is like Tree, but the first level of the tree holds a node for
+// each API, with the tests of that API below it.
+func (l Lists) APITree() *TreeNode {
+	root := &TreeNode{}
+	for api, tests := range l.testsByAPI() {
+		for test := range tests {
+			root.add(append([]string{string(api)}, strings.Split(test, ".")...))
+		}
+	}
+	root.sort()
+	return root
+}
+
+// add adds the test with the given name segments below n.
+func (n *TreeNode) add(segments []string) {
+	n.Leaves++
+	if len(segments) == 0 {
+		return
+	}
+	for _, child := range n.Children {
+		if child.Name == segments[0] {
+			child.add(segments[1:])
+			return
+		}
+	}
+	child := &TreeNode{Name: segments[0]}
+	n.Children = append(n.Children, child)
+	child.add(segments[1:])
+}
+
+// sort sorts the children of n and all its descendants by Name.
+func (n *TreeNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Name < n.Children[j].Name })
+	for _, child := range n.Children {
+		child.sort()
+	}
+}
+
+// String returns the tree as indented text, with one line per node of the
+// form '<name> (<leaves>)'.
+func (n *TreeNode) String() string {
+	sb := strings.Builder{}
+	n.write(&sb, 0)
+	return sb.String()
+}
+
+func (n *TreeNode) write(sb *strings.Builder, depth int) {
+	name := n.Name
+	if depth == 0 && name == "" {
+		name = "."
+	}
+	fmt.Fprintf(sb, "%s%s (%d)\n", strings.Repeat("  ", depth), name, n.Leaves)
+	for _, child := range n.Children {
+		child.write(sb, depth+1)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 The SwiftShader Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testlist
+
+import (
+	"math/big"
+	"sort"
+)
+
+// Universe assigns each distinct test of a set of lists a bit index, so that
+// lists can be represented as bitmaps, turning set operations between lists
+// into bit operations. Tests are identified by both API and test name, so a
+// test of one API never shares a bit with a same-named test of another API.
+type Universe struct {
+	tests   []universeTest       // bit index -> test
+	indices map[universeTest]int // test -> bit index
+}
+
+// universeTest is a single test of a Universe.
+type universeTest struct {
+	api  API
+	name string
+}
+
+// BuildUniverse returns a Universe of all the tests in lists. Bit indices are
+// assigned in API then test name order.
+func BuildUniverse(lists ...Lists) *Universe {
+	set := map[universeTest]bool{}
+	for _, l := range lists {
+		for api, tests := range l.testsByAPI() {
+			for name := range tests {
+				set[universeTest{api, name}] = true
+			}
+		}
+	}
+	u := &Universe{
+		tests:   make([]universeTest, 0, len(set)),
+		indices: make(map[universeTest]int, len(set)),
+	}
+	for test := range set {
+		u.tests = append(u.tests, test)
+	}
+	sort.Slice(u.tests, func(i, j int) bool {
+		if u.tests[i].api != u.tests[j].api {
+			return u.tests[i].api < u.tests[j].api
+		}
+		return u.tests[i].name < u.tests[j].name
+	})
+	for i, test := range u.tests {
+		u.indices[test] = i
+	}
+	return u
+}
+
+// Len returns the number of tests in the universe.
+func (u *Universe) Len() int { return len(u.tests) }
+
+// Tests returns the sorted test names of the set bits of bitmap, keyed by API.
+// Use FromMap to turn the result into a Lists.
+func (u *Universe) Tests(bitmap *big.Int) map[API][]string {
+	out := map[API][]string{}
+	for i, test := range u.tests {
+		if bitmap.Bit(i) != 0 {
+			out[test.api] = append(out[test.api], test.name)
+		}
+	}
+	return out
+}
+
+// Bitmap returns a bitmap with the bit of each test in l set. Tests that are
+// not in the universe are ignored. Bitmaps of the same universe can be
+// combined with the big.Int And, Or and AndNot methods to intersect, union
+// and subtract lists, matching tests by API and name like Intersect and
+// Subtract do with a nil Canonicalizer.
+func (l Lists) Bitmap(u *Universe) *big.Int {
+	out := new(big.Int)
+	for _, group := range l {
+		for _, test := range group.Tests {
+			if i, ok := u.indices[universeTest{group.API, test}]; ok {
+				out.SetBit(out, i, 1)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 The SwiftShader Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testlist
+
+import (
+	"math/big"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// sortedByAPI returns the sorted tests of l, keyed by API, in the form
+// returned by Universe.Tests.
+func sortedByAPI(l Lists) map[API][]string {
+	out := map[API][]string{}
+	for _, group := range l {
+		out[group.API] = append(out[group.API], group.Tests...)
+	}
+	for api, tests := range out {
+		sort.Strings(tests)
+		out[api] = tests
+	}
+	return out
+}
+
+func TestBitmapMatchesIntersectAndSubtract(t *testing.T) {
+	a := Lists{
+		{Name: "vk", API: Vulkan, Tests: []string{"a", "b", "c"}},
+		{Name: "gles", API: GLES3, Tests: []string{"a", "d"}},
+	}
+	b := Lists{
+		{Name: "vk", API: Vulkan, Tests: []string{"b", "d"}},
+		{Name: "gles", API: GLES3, Tests: []string{"c", "d"}},
+	}
+	u := BuildUniverse(a, b)
+	if u.Len() != 7 {
+		t.Errorf("Universe has %d tests, want 7", u.Len())
+	}
+	ba, bb := a.Bitmap(u), b.Bitmap(u)
+
+	and := u.Tests(new(big.Int).And(ba, bb))
+	if want := sortedByAPI(a.Intersect(b, nil)); !reflect.DeepEqual(and, want) {
+		t.Errorf("Bitmap And returned %v, Intersect returned %v", and, want)
+	}
+	andNot := u.Tests(new(big.Int).AndNot(ba, bb))
+	if want := sortedByAPI(a.Subtract(b, nil)); !reflect.DeepEqual(andNot, want) {
+		t.Errorf("Bitmap AndNot returned %v, Subtract returned %v", andNot, want)
+	}
+}
+
+func BenchmarkBitmapIntersect(b *testing.B) {
+	x, y := largeLists(100000), largeLists(50000)
+	u := BuildUniverse(x, y)
+	bx, by := x.Bitmap(u), y.Bitmap(u)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		new(big.Int).And(bx, by)
+	}
+}
+
+func BenchmarkSliceIntersect(b *testing.B) {
+	x, y := largeLists(100000), largeLists(50000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x.Intersect(y, nil)
+	}
+}